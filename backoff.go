@@ -0,0 +1,58 @@
+package dynoscaler
+
+import "time"
+
+// backoffDelay returns how long to wait before the next attempt after
+// the given number of consecutive failures. Starting from base, the
+// delay doubles with every failure until it reaches max. To keep
+// several scalers from retrying in lockstep, the delay is jittered
+// by randomly taking off up to half of it, but it never drops below
+// base. randInt63n must behave like rand.Int63n.
+func backoffDelay(base, max time.Duration, failures int, randInt63n func(int64) int64) time.Duration {
+	if failures <= 0 || base <= 0 || max <= base {
+		return base
+	}
+
+	d := base
+	for i := 0; i < failures && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		d = max
+	}
+
+	jitter := time.Duration(randInt63n(int64(d / 2)))
+	if d-jitter < base {
+		return base
+	}
+
+	return d - jitter
+}
+
+// nextInterval returns how long Monitor should sleep before the next
+// check of the worker configs with the given check interval, backing
+// off while the queues can't be listed or the Heroku API rate limit
+// has been hit.
+func (ds *DynoScaler) nextInterval(interval time.Duration) time.Duration {
+	ds.state.mu.Lock()
+	failures := ds.state.listFailures
+	ds.state.mu.Unlock()
+
+	d := backoffDelay(interval, ds.MaxBackoff, failures, ds.randInt63n)
+	if wait := ds.rateLimitWait(); wait > d {
+		d = wait
+	}
+
+	return d
+}
+
+// startupDelay returns how long Monitor should wait before the first
+// check, a random duration below ds.StartupJitter.
+func (ds *DynoScaler) startupDelay() time.Duration {
+	if ds.StartupJitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(ds.randInt63n(int64(ds.StartupJitter)))
+}
@@ -0,0 +1,127 @@
+package dynoscaler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	noJitter := func(n int64) int64 { return 0 }
+
+	for _, tc := range []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 20 * time.Second},
+		{2, 40 * time.Second},
+		{3, 60 * time.Second},
+		{100, 60 * time.Second},
+	} {
+		d := backoffDelay(10*time.Second, time.Minute, tc.failures, noJitter)
+		if d != tc.expected {
+			t.Errorf("expected delay after %d failures to be %s, got %s", tc.failures, tc.expected, d)
+		}
+	}
+}
+
+func TestBackoffDelayJitter(t *testing.T) {
+	maxJitter := func(n int64) int64 { return n - 1 }
+
+	d := backoffDelay(10*time.Second, time.Minute, 2, maxJitter)
+	if d < 20*time.Second || d >= 40*time.Second {
+		t.Errorf("expected jittered delay to be within [20s, 40s), got %s", d)
+	}
+
+	d = backoffDelay(10*time.Second, time.Minute, 1, maxJitter)
+	if d < 10*time.Second {
+		t.Errorf("expected jittered delay to never drop below 10s, got %s", d)
+	}
+}
+
+func TestNextIntervalBacksOffOnListQueuesErrors(t *testing.T) {
+	rmqc := &fakeRabbit{err: errors.New("connection refused")}
+	ds := newTestDynoScaler(&fakeHeroku{}, rmqc)
+	ds.CheckInterval = 10 * time.Second
+	ds.MaxBackoff = time.Minute
+	ds.randInt63n = func(n int64) int64 { return 0 }
+
+	if d := ds.nextInterval(ds.CheckInterval); d != 10*time.Second {
+		t.Errorf("expected initial interval to be 10s, got %s", d)
+	}
+
+	prev := ds.nextInterval(ds.CheckInterval)
+	for i := 0; i < 3; i++ {
+		if err := ds.CheckOnce(context.Background()); err == nil {
+			t.Fatal("expected error to not be nil")
+		}
+
+		d := ds.nextInterval(ds.CheckInterval)
+		if d <= prev {
+			t.Errorf("expected interval after failure %d to grow beyond %s, got %s", i+1, prev, d)
+		}
+		prev = d
+	}
+
+	rmqc.mu.Lock()
+	rmqc.err = nil
+	rmqc.mu.Unlock()
+	rmqc.setQueues(rabbithole.QueueInfo{Name: "foo"})
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if d := ds.nextInterval(ds.CheckInterval); d != 10*time.Second {
+		t.Errorf("expected interval after success to reset to 10s, got %s", d)
+	}
+}
+
+func TestMonitorContextStartupJitter(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 0}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.CheckInterval = time.Hour
+	ds.StartupJitter = time.Second
+	ds.Events = make(chan ScalingEvent, 1)
+
+	bounds := make(chan int64, 1)
+	ds.randInt63n = func(n int64) int64 {
+		select {
+		case bounds <- n:
+		default:
+		}
+
+		return int64(100 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Now()
+	go ds.MonitorContext(ctx)
+
+	select {
+	case <-ds.Events:
+	case <-time.After(time.Second):
+		t.Fatal("expected the first check to happen within StartupJitter")
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected the first check to be delayed by 100ms, got %s", elapsed)
+	}
+
+	if bound := <-bounds; bound != int64(time.Second) {
+		t.Errorf("expected the delay to be below StartupJitter, got a bound of %d", bound)
+	}
+}
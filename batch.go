@@ -0,0 +1,156 @@
+package dynoscaler
+
+import (
+	"context"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// quantityUpdate is the new quantity of a worker type.
+type quantityUpdate struct {
+	workerType string
+	quantity   int
+}
+
+// batchScaler is implemented by the Scalers which can scale several
+// worker types with a single call.
+type batchScaler interface {
+	setQuantities(ctx context.Context, updates []quantityUpdate) error
+}
+
+// setQuantities scales all of the worker types with a single batch
+// update of the Heroku formation.
+func (s *herokuScaler) setQuantities(ctx context.Context, updates []quantityUpdate) error {
+	var opts heroku.FormationBatchUpdateOpts
+	for _, u := range updates {
+		quantity := u.quantity
+
+		opts.Updates = append(opts.Updates, struct {
+			Quantity *int    `json:"quantity,omitempty" url:"quantity,omitempty,key"`
+			Size     *string `json:"size,omitempty" url:"size,omitempty,key"`
+			Type     string  `json:"type" url:"type,key"`
+		}{Quantity: &quantity, Type: u.workerType})
+	}
+
+	_, err := s.hs.FormationBatchUpdate(ctx, s.app, opts)
+	return err
+}
+
+// scaleAll scales the workers of the pending evaluations, and calls
+// AfterScale for each of them. The worker types of an app are scaled
+// with a single batch update when there are several of them, falling
+// back to updating them one by one if the batch update fails, e.g.
+// with a Heroku-compatible API which doesn't support it. It reports
+// which of them were scaled, and the error of each.
+func (ds *DynoScaler) scaleAll(
+	ctx context.Context,
+	scalers map[string]Scaler,
+	configs []int,
+	evs []evaluation,
+	pending []bool,
+) ([]bool, []error) {
+
+	errs := make([]error, len(configs))
+	byApp := make(map[string][]int)
+	var apps []string
+
+	for j, i := range configs {
+		if !pending[j] {
+			continue
+		}
+
+		app := ds.appOf(ds.workerConfigs[i])
+		if _, ok := byApp[app]; !ok {
+			apps = append(apps, app)
+		}
+		byApp[app] = append(byApp[app], j)
+	}
+
+	var single []int
+	for _, app := range apps {
+		js := byApp[app]
+
+		bs, ok := scalers[app].(batchScaler)
+		if !ok || len(js) < 2 {
+			single = append(single, js...)
+			continue
+		}
+
+		err := ds.scaleBatch(ctx, bs, app, configs, evs, js)
+		if err != nil && !isRateLimited(err) && ctx.Err() == nil {
+			ds.log.WithError(err).WithField("heroku_app", app).
+				Warn("failed to batch update Heroku formation, updating the worker types one by one")
+			single = append(single, js...)
+			continue
+		}
+
+		for _, j := range js {
+			errs[j] = err
+		}
+	}
+
+	parallel(len(single), ds.Concurrency, func(k int) {
+		j := single[k]
+		wc := ds.workerConfigs[configs[j]]
+		app := ds.appOf(wc)
+
+		errs[j] = ds.scale(ctx, scalers[app], app, wc.WorkerType, evs[j].newQuantity)
+	})
+
+	scaled := make([]bool, len(configs))
+	for j, i := range configs {
+		if !pending[j] {
+			continue
+		}
+
+		wc := ds.workerConfigs[i]
+		if errs[j] != nil {
+			ds.log.WithError(errs[j]).WithFields(logrus.Fields{
+				"heroku_app":   ds.appOf(wc),
+				"worker_type":  wc.WorkerType,
+				"new_quantity": evs[j].newQuantity,
+			}).Error("failed to update Heroku formation")
+		}
+
+		if ds.AfterScale != nil {
+			ds.AfterScale(wc, evs[j].oldQuantity, evs[j].newQuantity, errs[j])
+		}
+
+		scaled[j] = errs[j] == nil
+	}
+
+	return scaled, errs
+}
+
+// scaleBatch scales the worker types of the evaluations js of app with
+// a single call to bs, without retrying.
+func (ds *DynoScaler) scaleBatch(
+	ctx context.Context,
+	bs batchScaler,
+	app string,
+	configs []int,
+	evs []evaluation,
+	js []int,
+) error {
+
+	if wait := ds.rateLimitWait(); wait > 0 {
+		return errors.Errorf("holding off Heroku calls for %s due to rate limiting", wait)
+	}
+
+	updates := make([]quantityUpdate, 0, len(js))
+	for _, j := range js {
+		updates = append(updates, quantityUpdate{
+			workerType: ds.workerConfigs[configs[j]].WorkerType,
+			quantity:   evs[j].newQuantity,
+		})
+	}
+
+	err := bs.setQuantities(ctx, updates)
+	if err != nil {
+		ds.observeHerokuError(err)
+	}
+
+	return err
+}
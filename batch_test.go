@@ -0,0 +1,137 @@
+package dynoscaler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+// newBatchTestDynoScaler returns a DynoScaler scaling fooworker and
+// barworker up from zero.
+func newBatchTestDynoScaler(hs *fakeHeroku) DynoScaler {
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{
+		{Name: "foo", Messages: 10},
+		{Name: "bar", Messages: 1},
+	}}
+
+	hs.formations = []heroku.Formation{
+		{Type: "fooworker", Quantity: 0},
+		{Type: "barworker", Quantity: 0},
+	}
+
+	return newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+}
+
+func TestCheckOnceBatchesFormationUpdates(t *testing.T) {
+	hs := &fakeHeroku{}
+	ds := newBatchTestDynoScaler(hs)
+
+	var after []string
+	ds.AfterScale = func(wc WorkerConfig, from, to int, err error) {
+		if err != nil {
+			t.Errorf("expected AfterScale error to be nil, got %s", err.Error())
+		}
+
+		after = append(after, wc.WorkerType)
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := [][]formationUpdate{{
+		{app: "app", workerType: "fooworker", quantity: 2},
+		{app: "app", workerType: "barworker", quantity: 1},
+	}}
+	if batches := hs.batchCalls(); !reflect.DeepEqual(batches, expected) {
+		t.Errorf("expected formation batch updates to be %+v, got %+v", expected, batches)
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 0 {
+		t.Errorf("expected no individual formation updates, got %+v", updates)
+	}
+
+	if !reflect.DeepEqual(after, []string{"fooworker", "barworker"}) {
+		t.Errorf("expected AfterScale to be called for both worker types, got %v", after)
+	}
+}
+
+func TestCheckOnceSingleFormationUpdateIsNotBatched(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if batches := hs.batchCalls(); len(batches) != 0 {
+		t.Errorf("expected no formation batch updates, got %+v", batches)
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "bar", quantity: 1}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+}
+
+func TestCheckOnceFallsBackToIndividualFormationUpdates(t *testing.T) {
+	hs := &fakeHeroku{batchErr: errors.New("not found")}
+	ds := newBatchTestDynoScaler(hs)
+	ds.Logger.SetOutput(&bytes.Buffer{})
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if n := len(hs.batchCalls()); n != 1 {
+		t.Errorf("expected 1 formation batch update, got %d", n)
+	}
+
+	expected := []formationUpdate{
+		{app: "app", workerType: "fooworker", quantity: 2},
+		{app: "app", workerType: "barworker", quantity: 1},
+	}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+}
+
+func TestCheckOnceBatchRateLimited(t *testing.T) {
+	hs := &fakeHeroku{batchErr: heroku.Error{StatusCode: 429, ID: "rate_limit"}}
+	ds := newBatchTestDynoScaler(hs)
+	ds.Logger.SetOutput(&bytes.Buffer{})
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 0 {
+		t.Errorf("expected no individual formation updates after the rate limit, got %+v", updates)
+	}
+
+	if ds.rateLimitWait() == 0 {
+		t.Error("expected the Heroku calls to be held off")
+	}
+}
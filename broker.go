@@ -0,0 +1,84 @@
+package dynoscaler
+
+import (
+	"context"
+
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+	"github.com/sirupsen/logrus"
+)
+
+// alarmedNodes returns the names of the RabbitMQ nodes with an active
+// memory or disk alarm, in any of the RabbitMQ clusters.
+func (ds *DynoScaler) alarmedNodes(ctx context.Context) ([]string, error) {
+	var alarmed []string
+
+	for _, name := range ds.allClusterNames() {
+		c, err := ds.cluster(name)
+		if err != nil {
+			return nil, err
+		}
+
+		// the RabbitMQ client doesn't support contexts, and nodes is
+		// only read once the listing has returned
+		var nodes []rabbithole.NodeInfo
+		err = withContext(ctx, func() error {
+			var err error
+			nodes, err = c.client.ListNodes()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range nodes {
+			if node.MemAlarm || node.DiskFreeAlarm {
+				alarmed = append(alarmed, node.Name)
+			}
+		}
+	}
+
+	return alarmed, nil
+}
+
+// holdOnBrokerAlarm holds the scale-ups of the checked evaluations while
+// a RabbitMQ node has an alarm active, if HaltScaleUpOnBrokerAlarm is
+// set. The nodes are only listed when there is a scale-up to hold, and
+// failing to list them doesn't prevent the scaling.
+func (ds *DynoScaler) holdOnBrokerAlarm(ctx context.Context, configs []int, evs []evaluation, checked []bool) {
+	if !ds.HaltScaleUpOnBrokerAlarm {
+		return
+	}
+
+	var ups []int
+	for j := range evs {
+		if checked[j] && evs[j].decision == ScaleUp {
+			ups = append(ups, j)
+		}
+	}
+
+	if len(ups) == 0 {
+		return
+	}
+
+	alarmed, err := ds.alarmedNodes(ctx)
+	if err != nil {
+		ds.log.WithError(err).Warn("failed to check RabbitMQ nodes for alarms")
+		return
+	}
+
+	if len(alarmed) == 0 {
+		return
+	}
+
+	for _, j := range ups {
+		wc := ds.workerConfigs[configs[j]]
+		ds.log.WithFields(logrus.Fields{
+			"heroku_app":  ds.appOf(wc),
+			"worker_type": wc.WorkerType,
+			"nodes":       alarmed,
+		}).Warn("RabbitMQ has an alarm active, not scaling up")
+
+		evs[j].decision = Hold
+		evs[j].newQuantity = evs[j].oldQuantity
+	}
+}
@@ -0,0 +1,145 @@
+package dynoscaler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+func TestCheckOnceHaltsScaleUpOnBrokerAlarm(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{
+		{Type: "fooworker", Quantity: 1},
+		{Type: "barworker", Quantity: 2},
+	}}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{
+			{Name: "foo", Messages: 10},
+			{Name: "bar", Messages: 0},
+		},
+		nodes: []rabbithole.NodeInfo{
+			{Name: "rabbit@a"},
+			{Name: "rabbit@b", MemAlarm: true},
+		},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+	ds.HaltScaleUpOnBrokerAlarm = true
+	ds.Events = make(chan ScalingEvent, 2)
+
+	var buf bytes.Buffer
+	ds.Logger.SetOutput(&buf)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	// the scale-down still proceeds
+	expected := []formationUpdate{{app: "app", workerType: "barworker", quantity: 0}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+
+	if ev := <-ds.Events; ev.WorkerType != "fooworker" || ev.Decision != Hold || ev.Scaled {
+		t.Errorf("expected the scale-up of fooworker to be held, got %+v", ev)
+	}
+
+	if out := buf.String(); !strings.Contains(out, "RabbitMQ has an alarm active, not scaling up") || !strings.Contains(out, "rabbit@b") {
+		t.Errorf("expected the alarm to be logged, got %q", out)
+	}
+}
+
+func TestCheckOnceScalesUpWithoutBrokerAlarm(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}},
+		nodes:  []rabbithole.NodeInfo{{Name: "rabbit@a"}},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.HaltScaleUpOnBrokerAlarm = true
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "bar", quantity: 1}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+
+	if rmqc.nodeLists != 1 {
+		t.Errorf("expected the nodes to be listed once, got %d", rmqc.nodeLists)
+	}
+}
+
+func TestCheckOnceBrokerAlarmCheckFails(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{
+		queues:   []rabbithole.QueueInfo{{Name: "foo", Messages: 1}},
+		nodesErr: errors.New("access refused"),
+	}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.HaltScaleUpOnBrokerAlarm = true
+	ds.Logger.SetOutput(&bytes.Buffer{})
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if n := len(hs.updateCalls()); n != 1 {
+		t.Errorf("expected the worker to be scaled up anyway, got %d updates", n)
+	}
+}
+
+func TestCheckOnceBrokerAlarmNotCheckedWithoutScaleUp(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 1}}}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 0}},
+		nodes:  []rabbithole.NodeInfo{{Name: "rabbit@a", DiskFreeAlarm: true}},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.HaltScaleUpOnBrokerAlarm = true
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if rmqc.nodeLists != 0 {
+		t.Errorf("expected the nodes to not be listed, got %d", rmqc.nodeLists)
+	}
+
+	if n := len(hs.updateCalls()); n != 1 {
+		t.Errorf("expected the worker to be scaled down, got %d updates", n)
+	}
+}
@@ -0,0 +1,140 @@
+package dynoscaler
+
+import (
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// limitTotal reduces the new quantities of the checked evaluations
+// when they would exceed ds.MaxTotalWorkers, together with the
+// quantities of the worker configs outside of configs.
+//
+// The budget is allocated by Priority, from the highest to the lowest.
+// The worker configs of a priority get their full quantities while
+// the budget left over by the higher priorities allows it. Otherwise
+// the rest of the budget is split among them proportionally to their
+// quantities, with the workers left over by rounding down going to the
+// largest remainders, and the lower priorities get no workers at all.
+func (ds *DynoScaler) limitTotal(configs []int, evs []evaluation, checked []bool, planning bool) {
+	budget := ds.MaxTotalWorkers - ds.reservedWorkers(configs)
+	if budget < 0 {
+		budget = 0
+	}
+
+	total := 0
+	byPriority := make(map[int][]int)
+	var priorities []int
+
+	for j, ev := range evs {
+		if !checked[j] {
+			continue
+		}
+
+		total += ev.newQuantity
+
+		p := ds.workerConfigs[configs[j]].Priority
+		if _, ok := byPriority[p]; !ok {
+			priorities = append(priorities, p)
+		}
+		byPriority[p] = append(byPriority[p], j)
+	}
+
+	if total <= budget {
+		return
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+
+	quantities := make([]int, len(evs))
+	left := budget
+
+	for _, p := range priorities {
+		requested := 0
+		for _, j := range byPriority[p] {
+			requested += evs[j].newQuantity
+		}
+
+		if requested <= left {
+			for _, j := range byPriority[p] {
+				quantities[j] = evs[j].newQuantity
+			}
+
+			left -= requested
+			continue
+		}
+
+		share(byPriority[p], evs, quantities, left, requested)
+		left = 0
+	}
+
+	for j := range evs {
+		if !checked[j] || quantities[j] == evs[j].newQuantity {
+			continue
+		}
+
+		wc := ds.workerConfigs[configs[j]]
+		logHold(ds.log.WithFields(logrus.Fields{
+			"heroku_app":        ds.appOf(wc),
+			"worker_type":       wc.WorkerType,
+			"desired_quantity":  evs[j].newQuantity,
+			"new_quantity":      quantities[j],
+			"max_total_workers": ds.MaxTotalWorkers,
+		}), planning, "reducing workers to stay within MaxTotalWorkers")
+
+		evs[j].newQuantity = quantities[j]
+
+		switch {
+		case evs[j].newQuantity > evs[j].oldQuantity:
+			evs[j].decision = ScaleUp
+		case evs[j].newQuantity < evs[j].oldQuantity:
+			evs[j].decision = ScaleDown
+		default:
+			evs[j].decision = Hold
+		}
+	}
+}
+
+// share splits budget among the evaluations js, which request total
+// workers together, proportionally to their new quantities, and stores
+// the results in quantities.
+func share(js []int, evs []evaluation, quantities []int, budget, total int) {
+	remainders := make(map[int]int, len(js))
+	order := append([]int(nil), js...)
+	left := budget
+
+	for _, j := range js {
+		quantities[j] = evs[j].newQuantity * budget / total
+		remainders[j] = evs[j].newQuantity * budget % total
+		left -= quantities[j]
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+
+	for _, j := range order[:left] {
+		quantities[j]++
+	}
+}
+
+// reservedWorkers returns the number of workers of the worker configs
+// which aren't in configs, as of their last check.
+func (ds *DynoScaler) reservedWorkers(configs []int) int {
+	in := make(map[int]bool, len(configs))
+	for _, i := range configs {
+		in[i] = true
+	}
+
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	reserved := 0
+	for i, status := range ds.state.statuses {
+		if !in[i] {
+			reserved += status.CurrentQuantity
+		}
+	}
+
+	return reserved
+}
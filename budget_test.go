@@ -0,0 +1,183 @@
+package dynoscaler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+func TestCheckOnceMaxTotalWorkers(t *testing.T) {
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{
+			{Type: "fooworker", Quantity: 0},
+			{Type: "barworker", Quantity: 0},
+		},
+	}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{
+			{Name: "foo", Messages: 50},
+			{Name: "bar", Messages: 50},
+		},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 5},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 5},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+	ds.MaxTotalWorkers = 6
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := [][]formationUpdate{{
+		{app: "app", workerType: "fooworker", quantity: 3},
+		{app: "app", workerType: "barworker", quantity: 3},
+	}}
+	if batches := hs.batchCalls(); !reflect.DeepEqual(batches, expected) {
+		t.Errorf("expected formation batch updates to be %+v, got %+v", expected, batches)
+	}
+}
+
+func TestCheckOnceMaxTotalWorkersHolds(t *testing.T) {
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{
+			{Type: "fooworker", Quantity: 3},
+			{Type: "barworker", Quantity: 0},
+		},
+	}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{
+			{Name: "foo", Messages: 50},
+			{Name: "bar", Messages: 50},
+		},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 4},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 2},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+	ds.MaxTotalWorkers = 4
+	ds.Events = make(chan ScalingEvent, 2)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	// 4 and 2 workers are reduced to 2.67 and 1.33 workers, rounded to 3 and 1
+	expected := []formationUpdate{{app: "app", workerType: "barworker", quantity: 1}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+
+	if ev := <-ds.Events; ev.Decision != Hold {
+		t.Errorf("expected decision of fooworker to be hold, got %s", ev.Decision)
+	}
+}
+
+func TestLimitTotalReservesOtherConfigs(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "",
+		WorkerConfig{QueueName: "foo", WorkerType: "fooworker"},
+		WorkerConfig{QueueName: "bar", WorkerType: "barworker"},
+	)
+	ds.MaxTotalWorkers = 6
+	ds.state.statuses[1] = WorkerStatus{CurrentQuantity: 4}
+
+	evs := []evaluation{{oldQuantity: 0, newQuantity: 5, decision: ScaleUp}}
+	ds.limitTotal([]int{0}, evs, []bool{true}, false)
+
+	if evs[0].newQuantity != 2 {
+		t.Errorf("expected newQuantity to be 2, got %d", evs[0].newQuantity)
+	}
+
+	if evs[0].decision != ScaleUp {
+		t.Errorf("expected decision to be scale_up, got %s", evs[0].decision)
+	}
+}
+
+func TestCheckOnceMaxTotalWorkersPriority(t *testing.T) {
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{
+			{Type: "fooworker", Quantity: 0},
+			{Type: "barworker", Quantity: 0},
+		},
+	}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{
+			{Name: "foo", Messages: 50},
+			{Name: "bar", Messages: 50},
+		},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 5},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 5},
+			Priority:        1,
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+	ds.MaxTotalWorkers = 5
+	ds.Events = make(chan ScalingEvent, 2)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "barworker", quantity: 5}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+
+	if ev := <-ds.Events; ev.NewQuantity != 0 || ev.Decision != Hold {
+		t.Errorf("expected fooworker to be held at 0 workers, got %d (%s)", ev.NewQuantity, ev.Decision)
+	}
+}
+
+func TestLimitTotalPriorities(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "",
+		WorkerConfig{QueueName: "foo", WorkerType: "fooworker", Priority: 2},
+		WorkerConfig{QueueName: "bar", WorkerType: "barworker", Priority: 1},
+		WorkerConfig{QueueName: "baz", WorkerType: "bazworker", Priority: 1},
+		WorkerConfig{QueueName: "qux", WorkerType: "quxworker", Priority: -1},
+	)
+	ds.MaxTotalWorkers = 10
+
+	evs := []evaluation{
+		{newQuantity: 4, decision: ScaleUp},
+		{newQuantity: 6, decision: ScaleUp},
+		{newQuantity: 6, decision: ScaleUp},
+		{newQuantity: 2, decision: ScaleUp},
+	}
+	ds.limitTotal([]int{0, 1, 2, 3}, evs, []bool{true, true, true, true}, false)
+
+	for j, expected := range []int{4, 3, 3, 0} {
+		if evs[j].newQuantity != expected {
+			t.Errorf("expected newQuantity of config %d to be %d, got %d", j, expected, evs[j].newQuantity)
+		}
+	}
+}
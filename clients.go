@@ -0,0 +1,50 @@
+package dynoscaler
+
+import (
+	"context"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+// herokuClient is the part of the Heroku Platform API
+// used by the DynoScaler. It is satisfied by *heroku.Service.
+type herokuClient interface {
+	DynoList(ctx context.Context, appIdentity string, lr *heroku.ListRange) (heroku.DynoListResult, error)
+	FormationList(ctx context.Context, appIdentity string, lr *heroku.ListRange) (heroku.FormationListResult, error)
+	FormationUpdate(ctx context.Context, appIdentity string, formationIdentity string, o heroku.FormationUpdateOpts) (*heroku.Formation, error)
+	FormationBatchUpdate(ctx context.Context, appIdentity string, o heroku.FormationBatchUpdateOpts) (heroku.FormationBatchUpdateResult, error)
+	ReleaseList(ctx context.Context, appIdentity string, lr *heroku.ListRange) (heroku.ReleaseListResult, error)
+}
+
+// rabbitClient is the part of the RabbitMQ Management API
+// used by the DynoScaler. It is satisfied by *rabbithole.Client.
+type rabbitClient interface {
+	ListQueues() ([]rabbithole.QueueInfo, error)
+	ListQueuesIn(vhost string) ([]rabbithole.QueueInfo, error)
+	ListNodes() ([]rabbithole.NodeInfo, error)
+}
+
+// timedHeroku is a herokuClient which passes how long the formation
+// calls take to observe, which is called with the name of the call
+// and when it started.
+type timedHeroku struct {
+	herokuClient
+	observe func(call string, start time.Time)
+}
+
+func (th timedHeroku) FormationList(ctx context.Context, appIdentity string, lr *heroku.ListRange) (heroku.FormationListResult, error) {
+	defer th.observe("FormationList", time.Now())
+	return th.herokuClient.FormationList(ctx, appIdentity, lr)
+}
+
+func (th timedHeroku) FormationUpdate(ctx context.Context, appIdentity string, formationIdentity string, o heroku.FormationUpdateOpts) (*heroku.Formation, error) {
+	defer th.observe("FormationUpdate", time.Now())
+	return th.herokuClient.FormationUpdate(ctx, appIdentity, formationIdentity, o)
+}
+
+func (th timedHeroku) FormationBatchUpdate(ctx context.Context, appIdentity string, o heroku.FormationBatchUpdateOpts) (heroku.FormationBatchUpdateResult, error) {
+	defer th.observe("FormationBatchUpdate", time.Now())
+	return th.herokuClient.FormationBatchUpdate(ctx, appIdentity, o)
+}
@@ -0,0 +1,292 @@
+package dynoscaler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+// formationUpdate is a FormationUpdate call recorded by fakeHeroku.
+type formationUpdate struct {
+	app        string
+	workerType string
+	quantity   int
+}
+
+// fakeHeroku is a herokuClient which keeps the formations in
+// memory and records all of the updates made to them.
+type fakeHeroku struct {
+	mu         sync.Mutex
+	formations []heroku.Formation
+	dynos      []heroku.Dyno
+	updates    []formationUpdate
+
+	// the apps of the DynoList and FormationList calls made so far
+	dynoLists      []string
+	formationLists []string
+
+	dynoListErr      error
+	formationListErr error
+	updateErr        error
+	batchErr         error
+
+	// the FormationBatchUpdate calls made so far
+	batches [][]formationUpdate
+
+	releases       []heroku.Release
+	releaseListErr error
+	releaseLists   int
+
+	// errors returned by the next FormationUpdate calls,
+	// before falling back to updateErr
+	updateErrs []error
+}
+
+func (fh *fakeHeroku) DynoList(ctx context.Context, appIdentity string, lr *heroku.ListRange) (heroku.DynoListResult, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	fh.dynoLists = append(fh.dynoLists, appIdentity)
+
+	if fh.dynoListErr != nil {
+		return nil, fh.dynoListErr
+	}
+
+	return append(heroku.DynoListResult(nil), fh.dynos...), nil
+}
+
+func (fh *fakeHeroku) ReleaseList(ctx context.Context, appIdentity string, lr *heroku.ListRange) (heroku.ReleaseListResult, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	fh.releaseLists++
+
+	if fh.releaseListErr != nil {
+		return nil, fh.releaseListErr
+	}
+
+	return append(heroku.ReleaseListResult(nil), fh.releases...), nil
+}
+
+func (fh *fakeHeroku) FormationList(ctx context.Context, appIdentity string, lr *heroku.ListRange) (heroku.FormationListResult, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	fh.formationLists = append(fh.formationLists, appIdentity)
+
+	if fh.formationListErr != nil {
+		return nil, fh.formationListErr
+	}
+
+	return append(heroku.FormationListResult(nil), fh.formations...), nil
+}
+
+func (fh *fakeHeroku) FormationUpdate(ctx context.Context, appIdentity string, formationIdentity string, o heroku.FormationUpdateOpts) (*heroku.Formation, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	fh.updates = append(fh.updates, formationUpdate{
+		app:        appIdentity,
+		workerType: formationIdentity,
+		quantity:   *o.Quantity,
+	})
+
+	if len(fh.updateErrs) > 0 {
+		err := fh.updateErrs[0]
+		fh.updateErrs = fh.updateErrs[1:]
+		return nil, err
+	}
+
+	if fh.updateErr != nil {
+		return nil, fh.updateErr
+	}
+
+	for i := range fh.formations {
+		if fh.formations[i].Type == formationIdentity {
+			fh.formations[i].Quantity = *o.Quantity
+			return &fh.formations[i], nil
+		}
+	}
+
+	return &heroku.Formation{Type: formationIdentity, Quantity: *o.Quantity}, nil
+}
+
+func (fh *fakeHeroku) FormationBatchUpdate(ctx context.Context, appIdentity string, o heroku.FormationBatchUpdateOpts) (heroku.FormationBatchUpdateResult, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	var batch []formationUpdate
+	for _, u := range o.Updates {
+		batch = append(batch, formationUpdate{app: appIdentity, workerType: u.Type, quantity: *u.Quantity})
+	}
+	fh.batches = append(fh.batches, batch)
+
+	if fh.batchErr != nil {
+		return nil, fh.batchErr
+	}
+
+	var result heroku.FormationBatchUpdateResult
+	for _, u := range o.Updates {
+		for i := range fh.formations {
+			if fh.formations[i].Type == u.Type {
+				fh.formations[i].Quantity = *u.Quantity
+				result = append(result, fh.formations[i])
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// batchCalls returns the FormationBatchUpdate calls made so far.
+func (fh *fakeHeroku) batchCalls() [][]formationUpdate {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	return append([][]formationUpdate(nil), fh.batches...)
+}
+
+// updateCalls returns the FormationUpdate calls made so far.
+func (fh *fakeHeroku) updateCalls() []formationUpdate {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	return append([]formationUpdate(nil), fh.updates...)
+}
+
+// fakeRabbit is a rabbitClient which serves the queues from memory.
+type fakeRabbit struct {
+	mu     sync.Mutex
+	queues []rabbithole.QueueInfo
+	err    error
+	calls  int
+	vhosts []string
+
+	// errors returned by the next calls, before falling back to
+	// err, where nil means the call succeeds
+	errs []error
+
+	nodes     []rabbithole.NodeInfo
+	nodesErr  error
+	nodeLists int
+
+	// timestamps of the head messages, by queue name
+	heads map[string]time.Time
+}
+
+func (fr *fakeRabbit) ListQueues() ([]rabbithole.QueueInfo, error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.calls++
+
+	if err := fr.nextErr(); err != nil {
+		return nil, err
+	}
+
+	return append([]rabbithole.QueueInfo(nil), fr.queues...), nil
+}
+
+func (fr *fakeRabbit) ListQueuesIn(vhost string) ([]rabbithole.QueueInfo, error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.calls++
+	fr.vhosts = append(fr.vhosts, vhost)
+
+	if err := fr.nextErr(); err != nil {
+		return nil, err
+	}
+
+	var queues []rabbithole.QueueInfo
+	for _, q := range fr.queues {
+		if q.Vhost == vhost {
+			queues = append(queues, q)
+		}
+	}
+
+	return queues, nil
+}
+
+func (fr *fakeRabbit) ListNodes() ([]rabbithole.NodeInfo, error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.nodeLists++
+
+	if fr.nodesErr != nil {
+		return nil, fr.nodesErr
+	}
+
+	return append([]rabbithole.NodeInfo(nil), fr.nodes...), nil
+}
+
+func (fr *fakeRabbit) HeadMessageTimestamp(ctx context.Context, vhost, queue string) (time.Time, bool, error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	head, ok := fr.heads[queue]
+	return head, ok, nil
+}
+
+// nextErr returns the error of the next call. The caller must hold fr.mu.
+func (fr *fakeRabbit) nextErr() error {
+	if len(fr.errs) > 0 {
+		err := fr.errs[0]
+		fr.errs = fr.errs[1:]
+		return err
+	}
+
+	return fr.err
+}
+
+// setQueues replaces the queues served by the fake.
+func (fr *fakeRabbit) setQueues(queues ...rabbithole.QueueInfo) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.queues = queues
+}
+
+// newTestDynoScaler returns a DynoScaler using the fake clients.
+func newTestDynoScaler(hs *fakeHeroku, rmqc *fakeRabbit, workerConfigs ...WorkerConfig) DynoScaler {
+	ds := NewDynoScaler("", "", "", "", "app", WithWorkerConfigs(workerConfigs...))
+	ds.hs = hs
+	ds.rmqc = rmqc
+
+	return ds
+}
+
+// checkOnce checks qc with CheckOnce, using the fake RabbitMQ of ds
+// (or a new one) to list queues and a new fake Heroku to list a copy
+// of formations, and returns the scaling event of the check.
+func checkOnce(ds *DynoScaler, qc WorkerConfig, queues []rabbithole.QueueInfo, formations []heroku.Formation) (ScalingEvent, error) {
+	rmqc, ok := ds.rmqc.(*fakeRabbit)
+	if !ok {
+		rmqc = &fakeRabbit{}
+		ds.rmqc = rmqc
+	}
+
+	rmqc.setQueues(queues...)
+	ds.hs = &fakeHeroku{formations: append([]heroku.Formation(nil), formations...)}
+	ds.workerConfigs = []WorkerConfig{qc}
+
+	events := ds.Events
+	defer func() { ds.Events = events }()
+	ds.Events = make(chan ScalingEvent, 1)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		return ScalingEvent{}, err
+	}
+
+	select {
+	case ev := <-ds.Events:
+		return ev, nil
+	default:
+		return ScalingEvent{}, errors.New("expected a scaling event")
+	}
+}
@@ -0,0 +1,66 @@
+package dynoscaler
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// rabbitMQCluster is a RabbitMQ cluster added with WithRabbitMQCluster.
+type rabbitMQCluster struct {
+	host     string
+	username string
+	password string
+	client   rabbitClient
+}
+
+// cluster returns the RabbitMQ cluster with the given name, or the one
+// given to NewDynoScaler if the name is empty.
+func (ds *DynoScaler) cluster(name string) (*rabbitMQCluster, error) {
+	if name == "" {
+		return &rabbitMQCluster{
+			host:     ds.rabbitMQHost,
+			username: ds.rabbitMQUsername,
+			password: ds.rabbitMQPassword,
+			client:   ds.rmqc,
+		}, nil
+	}
+
+	c, ok := ds.clusters[name]
+	if !ok {
+		return nil, errors.Errorf("RabbitMQ cluster %s is not configured", name)
+	}
+
+	return c, nil
+}
+
+// clusterNames returns the names of the RabbitMQ clusters of the worker
+// configs with the given indexes, sorted. The cluster given to
+// NewDynoScaler is always included, as the empty name.
+func (ds *DynoScaler) clusterNames(configs []int) []string {
+	names := []string{""}
+	seen := map[string]bool{"": true}
+
+	for _, i := range configs {
+		name := ds.workerConfigs[i].RabbitMQCluster
+		if !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// allClusterNames returns the names of all of the RabbitMQ clusters,
+// sorted, including the empty name of the one given to NewDynoScaler.
+func (ds *DynoScaler) allClusterNames() []string {
+	names := []string{""}
+	for name := range ds.clusters {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,75 @@
+package dynoscaler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+func TestCheckOnceRabbitMQClusters(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{
+		{Type: "usworker", Quantity: 1},
+		{Type: "euworker", Quantity: 1},
+	}}
+
+	// the clusters have a queue of the same name
+	us := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+	eu := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 30}}}
+
+	ds := newTestDynoScaler(hs, us, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2, 30: 5},
+		QueueName:       "foo",
+		WorkerType:      "usworker",
+	}, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2, 30: 5},
+		QueueName:       "foo",
+		WorkerType:      "euworker",
+		RabbitMQCluster: "eu",
+	})
+	ds.clusters = map[string]*rabbitMQCluster{"eu": {client: eu}}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	calls := hs.updateCalls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 formation update, got %d", len(calls))
+	}
+
+	if calls[0].workerType != "euworker" || calls[0].quantity != 5 {
+		t.Errorf("expected euworker to be scaled to 5, got %s to %d", calls[0].workerType, calls[0].quantity)
+	}
+
+	if n := us.calls; n != 1 {
+		t.Errorf("expected the queues of the default cluster to be listed once, got %d", n)
+	}
+
+	if n := eu.calls; n != 1 {
+		t.Errorf("expected the queues of cluster eu to be listed once, got %d", n)
+	}
+}
+
+func TestCheckOnceUnknownRabbitMQCluster(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 1}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+		RabbitMQCluster: "eu",
+	})
+
+	err := ds.CheckOnce(context.Background())
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if !strings.Contains(err.Error(), "RabbitMQ cluster eu is not configured") {
+		t.Errorf("expected error about the unknown cluster, got %s", err.Error())
+	}
+}
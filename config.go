@@ -0,0 +1,147 @@
+package dynoscaler
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config holds the settings of a DynoScaler, so that they can be kept
+// in a configuration file instead of code. See LoadConfig for loading
+// it from a YAML file, and NewDynoScalerFromConfig for using it.
+type Config struct {
+	RabbitMQ struct {
+		Host     string `yaml:"host"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		Port     int    `yaml:"port"`
+		Vhost    string `yaml:"vhost"`
+
+		// Additional clusters by name, see WithRabbitMQCluster.
+		Clusters map[string]struct {
+			Host     string `yaml:"host"`
+			Username string `yaml:"username"`
+			Password string `yaml:"password"`
+		} `yaml:"clusters"`
+	} `yaml:"rabbitmq"`
+
+	Heroku struct {
+		APIKey string `yaml:"api_key"`
+		App    string `yaml:"app"`
+		URL    string `yaml:"url"`
+	} `yaml:"heroku"`
+
+	// Optional settings of the DynoScaler, see the DynoScaler fields
+	// with the same names. Durations are written like "10s" or "5m".
+	// The defaults of NewDynoScaler are used for the missing ones.
+	CheckInterval      time.Duration `yaml:"check_interval"`
+	MaxBackoff         time.Duration `yaml:"max_backoff"`
+	ScaleUpCooldown    time.Duration `yaml:"scale_up_cooldown"`
+	ScaleDownCooldown  time.Duration `yaml:"scale_down_cooldown"`
+	ScaleRetries       int           `yaml:"scale_retries"`
+	MaxTotalWorkers    int           `yaml:"max_total_workers"`
+	WorkerCeiling      int           `yaml:"worker_ceiling"`
+	StartupJitter      time.Duration `yaml:"startup_jitter"`
+	PostDeployGrace    time.Duration `yaml:"post_deploy_grace"`
+	CycleTimeout       time.Duration `yaml:"cycle_timeout"`
+	FormationMaxAge    time.Duration `yaml:"formation_max_age"`
+	QueueLookupRetries int           `yaml:"queue_lookup_retries"`
+	DryRun             bool          `yaml:"dry_run"`
+	WebhookURL         string        `yaml:"webhook_url"`
+	SlackWebhookURL    string        `yaml:"slack_webhook_url"`
+
+	// Path of the JSON file of a FileStateStore, if set.
+	StateFile string `yaml:"state_file"`
+
+	Workers []WorkerConfig `yaml:"workers"`
+}
+
+// LoadConfig reads the Config from the YAML file at path, for example:
+//
+//	rabbitmq:
+//	  host: baboon.rmq.cloudamqp.com
+//	  username: username
+//	  password: password
+//	heroku:
+//	  api_key: heroku Platform API key
+//	  app: heroku app name
+//	check_interval: 30s
+//	workers:
+//	  - queue_name: bar
+//	    worker_type: mainworker
+//	    msg_worker_ratios: {1: 1, 10: 2, 30: 5}
+//
+// Unknown keys are rejected, so that typos don't go unnoticed.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, errors.Wrap(err, "failed to read config")
+	}
+
+	// the errors of yaml include the line number
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return cfg, errors.Wrapf(err, "failed to parse config %s", path)
+	}
+
+	return cfg, nil
+}
+
+// NewDynoScalerFromConfig initializes a new DynoScaler using cfg, in
+// the same way as NewDynoScaler.
+func NewDynoScalerFromConfig(cfg Config) DynoScaler {
+	opts := []Option{WithWorkerConfigs(cfg.Workers...)}
+
+	// passed as an option, so that it is raised to MinCheckInterval
+	// just like the one of NewDynoScaler
+	if cfg.CheckInterval != 0 {
+		opts = append(opts, WithCheckInterval(cfg.CheckInterval))
+	}
+
+	for name, c := range cfg.RabbitMQ.Clusters {
+		opts = append(opts, WithRabbitMQCluster(name, c.Host, c.Username, c.Password))
+	}
+
+	ds := NewDynoScaler(
+		cfg.RabbitMQ.Host,
+		cfg.RabbitMQ.Username,
+		cfg.RabbitMQ.Password,
+		cfg.Heroku.APIKey,
+		cfg.Heroku.App,
+		opts...,
+	)
+
+	ds.RabbitMQPort = cfg.RabbitMQ.Port
+	ds.Vhost = cfg.RabbitMQ.Vhost
+	ds.HerokuURL = cfg.Heroku.URL
+
+	if cfg.MaxBackoff != 0 {
+		ds.MaxBackoff = cfg.MaxBackoff
+	}
+
+	if cfg.WorkerCeiling != 0 {
+		ds.WorkerCeiling = cfg.WorkerCeiling
+	}
+
+	ds.ScaleUpCooldown = cfg.ScaleUpCooldown
+	ds.ScaleDownCooldown = cfg.ScaleDownCooldown
+	ds.ScaleRetries = cfg.ScaleRetries
+	ds.MaxTotalWorkers = cfg.MaxTotalWorkers
+	ds.StartupJitter = cfg.StartupJitter
+	ds.PostDeployGrace = cfg.PostDeployGrace
+	ds.CycleTimeout = cfg.CycleTimeout
+	ds.FormationMaxAge = cfg.FormationMaxAge
+	ds.QueueLookupRetries = cfg.QueueLookupRetries
+	ds.DryRun = cfg.DryRun
+	ds.WebhookURL = cfg.WebhookURL
+	ds.SlackWebhookURL = cfg.SlackWebhookURL
+
+	if cfg.StateFile != "" {
+		ds.StateStore = NewFileStateStore(cfg.StateFile)
+	}
+
+	return ds
+}
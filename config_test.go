@@ -0,0 +1,164 @@
+package dynoscaler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig("testdata/config.yaml")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	ds := NewDynoScalerFromConfig(cfg)
+
+	if ds.rabbitMQHost != "baboon.rmq.cloudamqp.com" {
+		t.Errorf("expected RabbitMQ host to be baboon.rmq.cloudamqp.com, got %s", ds.rabbitMQHost)
+	}
+
+	if ds.rabbitMQUsername != "username" || ds.rabbitMQPassword != "password" {
+		t.Error("expected RabbitMQ credentials to be set")
+	}
+
+	if ds.RabbitMQPort != 8443 {
+		t.Errorf("expected RabbitMQPort to be 8443, got %d", ds.RabbitMQPort)
+	}
+
+	if c := ds.clusters["eu"]; c == nil || c.host != "jaguar.rmq.cloudamqp.com" || c.username != "eu-username" {
+		t.Errorf("expected RabbitMQ cluster eu to be added, got %+v", c)
+	}
+
+	if ds.herokuAPIKey != "apikey" || ds.herokuAppID != "app" {
+		t.Error("expected Heroku settings to be set")
+	}
+
+	if ds.CheckInterval != 30*time.Second {
+		t.Errorf("expected CheckInterval to be 30s, got %s", ds.CheckInterval)
+	}
+
+	if ds.MaxBackoff != 5*time.Minute {
+		t.Errorf("expected MaxBackoff to keep its default of 5m, got %s", ds.MaxBackoff)
+	}
+
+	if ds.ScaleDownCooldown != 5*time.Minute {
+		t.Errorf("expected ScaleDownCooldown to be 5m, got %s", ds.ScaleDownCooldown)
+	}
+
+	if ds.ScaleRetries != 2 {
+		t.Errorf("expected ScaleRetries to be 2, got %d", ds.ScaleRetries)
+	}
+
+	expected := []WorkerConfig{
+		{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2, 30: 5},
+			RatioMode:       RatioByPublishRate,
+			MinWorkers:      1,
+			MaxWorkers:      10,
+			QueueNames:      []string{"bar", "baz"},
+			WorkerType:      "mainworker",
+			RabbitMQCluster: "eu",
+		},
+	}
+
+	if !reflect.DeepEqual(ds.workerConfigs, expected) {
+		t.Errorf("expected worker configs to be %+v, got %+v", expected, ds.workerConfigs)
+	}
+
+	if err := ds.ValidateConfig(); err != nil {
+		t.Errorf("expected loaded config to be valid, got %s", err.Error())
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid.yaml")
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if !strings.Contains(err.Error(), "testdata/invalid.yaml") || !strings.Contains(err.Error(), "line 6") {
+		t.Errorf("expected error to include the file and line, got %s", err.Error())
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	if _, err := LoadConfig("testdata/missing.yaml"); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+}
+
+func TestRatioModeText(t *testing.T) {
+	for _, mode := range []RatioMode{RatioByDepth, RatioByPublishRate, RatioLinear, RatioByMessageAge, RatioByUnacked} {
+		text, err := mode.MarshalText()
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		var decoded RatioMode
+		if err := decoded.UnmarshalText(text); err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if decoded != mode {
+			t.Errorf("expected %s to round-trip, got %s", mode, decoded)
+		}
+	}
+
+	var mode RatioMode
+	if err := mode.UnmarshalText([]byte("bogus")); err == nil {
+		t.Error("expected error for an unknown ratio mode")
+	}
+}
+
+func TestThresholdPolicyText(t *testing.T) {
+	for _, policy := range []ThresholdPolicy{ThresholdNone, ThresholdOr, ThresholdAnd} {
+		text, err := policy.MarshalText()
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		var decoded ThresholdPolicy
+		if err := decoded.UnmarshalText(text); err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if decoded != policy {
+			t.Errorf("expected %s to round-trip, got %s", policy, decoded)
+		}
+	}
+
+	var policy ThresholdPolicy
+	if err := policy.UnmarshalText([]byte("xor")); err == nil {
+		t.Error("expected error for an unknown threshold policy")
+	}
+}
+
+func TestRoundingModeText(t *testing.T) {
+	for _, mode := range []RoundingMode{RoundUp, RoundDown, RoundNearest} {
+		text, err := mode.MarshalText()
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		var decoded RoundingMode
+		if err := decoded.UnmarshalText(text); err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if decoded != mode {
+			t.Errorf("expected %s to round-trip, got %s", mode, decoded)
+		}
+	}
+
+	var mode RoundingMode
+	if err := mode.UnmarshalText([]byte("sideways")); err == nil {
+		t.Error("expected error for an unknown rounding mode")
+	}
+}
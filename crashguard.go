@@ -0,0 +1,75 @@
+package dynoscaler
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// crashDetector is implemented by the Scalers which can tell
+// whether the workers of a type are crashing.
+type crashDetector interface {
+	crashing(ctx context.Context, workerType string) (bool, error)
+}
+
+// crashing reports whether the CrashGuard should prevent qc from
+// being scaled up. Failing to tell doesn't prevent the scaling.
+func (ds *DynoScaler) crashing(ctx context.Context, sc Scaler, qc WorkerConfig) bool {
+	cd, ok := sc.(crashDetector)
+	if !ok {
+		return false
+	}
+
+	log := ds.log.WithFields(logrus.Fields{
+		"heroku_app":  ds.appOf(qc),
+		"worker_type": qc.WorkerType,
+	})
+
+	crashing, err := cd.crashing(ctx, qc.WorkerType)
+	if err != nil {
+		ds.observeHerokuError(err)
+		log.WithError(err).Warn("failed to check for crashing dynos")
+		return false
+	}
+
+	if crashing {
+		log.Warn("dynos are crashing or starting, not scaling up")
+	}
+
+	return crashing
+}
+
+// crashing reports whether at least half of the dynos of workerType
+// are crashed or starting. The dynos are listed only once.
+func (s *herokuScaler) crashing(ctx context.Context, workerType string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dynosListed {
+		s.dynos, s.dynosErr = s.hs.DynoList(ctx, s.app, nil)
+		s.dynosListed = true
+
+		if s.dynosErr != nil {
+			s.dynosErr = errors.Wrap(s.dynosErr, "failed to list dynos")
+		}
+	}
+
+	if s.dynosErr != nil {
+		return false, s.dynosErr
+	}
+
+	var total, unhealthy int
+	for _, d := range s.dynos {
+		if d.Type != workerType {
+			continue
+		}
+
+		total++
+		if d.State == "crashed" || d.State == "starting" {
+			unhealthy++
+		}
+	}
+
+	return total > 0 && unhealthy*2 >= total, nil
+}
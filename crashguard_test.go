@@ -0,0 +1,115 @@
+package dynoscaler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+func newCrashGuardTest(dynos ...heroku.Dyno) (*fakeHeroku, DynoScaler) {
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{{Type: "bar", Quantity: 2}},
+		dynos:      dynos,
+	}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 100}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 100: 10},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.CrashGuard = true
+
+	return hs, ds
+}
+
+func TestCrashGuardCrashed(t *testing.T) {
+	hs, ds := newCrashGuardTest(
+		heroku.Dyno{Type: "bar", State: "crashed"},
+		heroku.Dyno{Type: "bar", State: "up"},
+		heroku.Dyno{Type: "web", State: "up"},
+	)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if n := len(hs.updateCalls()); n != 0 {
+		t.Errorf("expected no formation updates, got %d", n)
+	}
+
+	// the cooldown must not be started by the skipped scale-up
+	ds.ScaleUpCooldown = time.Hour
+	hs.dynos = nil
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if n := len(hs.updateCalls()); n != 1 {
+		t.Errorf("expected 1 formation update once the dynos recover, got %d", n)
+	}
+}
+
+func TestCrashGuardHealthy(t *testing.T) {
+	hs, ds := newCrashGuardTest(
+		heroku.Dyno{Type: "bar", State: "crashed"},
+		heroku.Dyno{Type: "bar", State: "up"},
+		heroku.Dyno{Type: "bar", State: "up"},
+	)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if n := len(hs.updateCalls()); n != 1 {
+		t.Errorf("expected 1 formation update, got %d", n)
+	}
+}
+
+func TestCrashGuardDisabled(t *testing.T) {
+	hs, ds := newCrashGuardTest(heroku.Dyno{Type: "bar", State: "crashed"})
+	ds.CrashGuard = false
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if n := len(hs.updateCalls()); n != 1 {
+		t.Errorf("expected 1 formation update, got %d", n)
+	}
+
+	if len(hs.dynoLists) != 0 {
+		t.Error("expected dynos to not be listed")
+	}
+}
+
+func TestCrashGuardDynoListError(t *testing.T) {
+	hs, ds := newCrashGuardTest()
+	hs.dynoListErr = errors.New("unavailable")
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if n := len(hs.updateCalls()); n != 1 {
+		t.Errorf("expected 1 formation update, got %d", n)
+	}
+}
+
+func TestCrashGuardScaleDown(t *testing.T) {
+	hs, ds := newCrashGuardTest(heroku.Dyno{Type: "bar", State: "crashed"})
+	ds.rmqc = &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 0}}}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if n := len(hs.updateCalls()); n != 1 {
+		t.Errorf("expected scaling down to not be affected, got %d updates", n)
+	}
+}
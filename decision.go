@@ -0,0 +1,48 @@
+package dynoscaler
+
+import "fmt"
+
+// Decision is the outcome of checking whether to scale a worker.
+type Decision int
+
+const (
+	// NoChange means the worker is already running the number of
+	// dynos it should be running.
+	NoChange Decision = iota
+
+	// ScaleUp means the worker is scaled up.
+	ScaleUp
+
+	// ScaleDown means the worker is scaled down.
+	ScaleDown
+
+	// Hold means the worker is running more dynos than the queue
+	// calls for, but they are kept until the queue is empty, or that
+	// scaling up is held off, e.g. by the CrashGuard or a broker alarm.
+	Hold
+
+	// CooldownSuppressed means the worker should be scaled, but the
+	// ScaleUpCooldown or ScaleDownCooldown hasn't passed yet.
+	CooldownSuppressed
+)
+
+var decisionNames = map[Decision]string{
+	NoChange:           "no_change",
+	ScaleUp:            "scale_up",
+	ScaleDown:          "scale_down",
+	Hold:               "hold",
+	CooldownSuppressed: "cooldown_suppressed",
+}
+
+func (d Decision) String() string {
+	if name, ok := decisionNames[d]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Decision(%d)", int(d))
+}
+
+// scales reports whether the decision is to change the number of dynos.
+func (d Decision) scales() bool {
+	return d == ScaleUp || d == ScaleDown
+}
@@ -0,0 +1,100 @@
+package dynoscaler
+
+import (
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+func TestCheckOnceDecision(t *testing.T) {
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+
+	cases := []struct {
+		name     string
+		msgs     int
+		current  int
+		expected Decision
+		quantity int
+	}{
+		{"empty queue without workers", 0, 0, NoChange, 0},
+		{"enough workers", 10, 2, NoChange, 2},
+		{"more messages", 10, 0, ScaleUp, 2},
+		{"empty queue", 0, 3, ScaleDown, 0},
+		{"more workers than needed", 1, 3, Hold, 3},
+	}
+
+	for _, c := range cases {
+		ds := NewDynoScaler("", "", "", "", "")
+
+		ev, err := checkOnce(&ds, wc,
+			[]rabbithole.QueueInfo{{Name: "foo", Messages: c.msgs}},
+			[]heroku.Formation{{Type: "bar", Quantity: c.current}},
+		)
+		if err != nil {
+			t.Fatalf("%s: expected error to be nil, got %s", c.name, err.Error())
+		}
+
+		if ev.Decision != c.expected {
+			t.Errorf("%s: expected decision to be %s, got %s", c.name, c.expected, ev.Decision)
+		}
+
+		if ev.NewQuantity != c.quantity {
+			t.Errorf("%s: expected newQuantity to be %d, got %d", c.name, c.quantity, ev.NewQuantity)
+		}
+	}
+}
+
+func TestCheckOnceDecisionCooldownSuppressed(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+	ds.ScaleUpCooldown = time.Minute
+
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+
+	ev, err := checkOnce(&ds, wc,
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 1}},
+		[]heroku.Formation{{Type: "bar", Quantity: 0}},
+	)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.Decision != ScaleUp {
+		t.Fatalf("expected decision to be scale_up, got %s", ev.Decision)
+	}
+
+	ev, err = checkOnce(&ds, wc,
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 10}},
+		[]heroku.Formation{{Type: "bar", Quantity: 1}},
+	)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.Decision != CooldownSuppressed {
+		t.Errorf("expected decision to be cooldown_suppressed, got %s", ev.Decision)
+	}
+
+	if ev.NewQuantity != 1 {
+		t.Errorf("expected newQuantity to be 1, got %d", ev.NewQuantity)
+	}
+}
+
+func TestDecisionString(t *testing.T) {
+	if s := Hold.String(); s != "hold" {
+		t.Errorf("expected hold, got %s", s)
+	}
+
+	if s := Decision(42).String(); s != "Decision(42)" {
+		t.Errorf("expected Decision(42), got %s", s)
+	}
+}
@@ -20,10 +20,9 @@ combined with pre-defined message-worker ratios.
 			QueueName:       "bar",
 			WorkerType:      "mainworker",
 		},
+		dynoscaler.WithLogLevel(logrus.WarnLevel),
 	)
 
-	ds.Logger.SetLevel(logrus.InfoLevel)
-
 	err = ds.Monitor()
 	logrus.WithError(err).Error("dynoscaler monitoring failed")
 
@@ -33,7 +32,14 @@ package dynoscaler
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	heroku "github.com/heroku/heroku-go/v3"
@@ -42,6 +48,15 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// queueIdle is the status of a RabbitMQ queue which isn't receiving
+// or delivering any messages.
+const queueIdle = "idle"
+
+// MinCheckInterval is the shortest check interval that is used, also
+// for the worker configs, so that the checks don't hammer the APIs and
+// get rate limited.
+const MinCheckInterval = time.Second
+
 // DynoScaler has the ability to scale dynos on Heroku
 // according to some configuration combined with details
 // about the message counts in a RabbitMQ queue.
@@ -53,189 +68,1828 @@ type DynoScaler struct {
 	herokuAppID      string
 	workerConfigs    []WorkerConfig
 	log              *logrus.Entry
+	state            *scalingState
+	now              func() time.Time
+	randInt63n       func(int64) int64
+	retryDelay       time.Duration
+	minInterval      time.Duration
+	metrics          *metrics
+	hs               herokuClient
+	rmqc             rabbitClient
+	clusters         map[string]*rabbitMQCluster
+
+	// Port of the RabbitMQ Management API, for brokers which don't
+	// expose it on the default port of the scheme. Zero means the
+	// default port is used.
+	RabbitMQPort int
+
+	// Name of the RabbitMQ virtual host the queues live in. When
+	// set, only the queues of that vhost are considered, otherwise
+	// the queues of all of the vhosts visible to the user are.
+	Vhost string
+
+	// If set, used instead of the RabbitMQ Management API to list the
+	// queues, e.g. a PrometheusQueueSource for brokers which only
+	// expose their metrics. The worker configs tracking its queues
+	// can't use RatioByPublishRate.
+	QueueSource QueueSource
+
+	// If set, the times the worker types were last scaled are loaded
+	// from it by the first check, and saved to it after every check,
+	// so that the cooldowns, the ScaleToZeroDelay and the
+	// ScaleDownBufferTTL survive restarts, e.g. a FileStateStore. The
+	// default keeps them in memory only.
+	StateStore StateStore
+
+	// If set, used for the requests to the RabbitMQ Management API,
+	// e.g. to route them through a proxy or to trust the CA
+	// certificate of a self-signed instance.
+	RabbitMQTransport *http.Transport
 
-	// How long to sleep between the checks.
+	// How many times to list the queues again during a check while
+	// a queue of the worker configs is missing from them, as the
+	// RabbitMQ Management API sometimes leaves out a queue which does
+	// exist. Zero means a missing queue fails the check of its worker
+	// config right away.
+	QueueLookupRetries int
+
+	// Timeout of the requests to the RabbitMQ Management API.
+	// Zero means there is no timeout.
+	RabbitMQTimeout time.Duration
+
+	// If set, used instead of the Heroku formation to get and set
+	// the number of workers, e.g. for a different platform. The
+	// HerokuAppID of the worker configs is only used for logging then.
+	Scaler Scaler
+
+	// Base URL of the Heroku Platform API, e.g. for a mock server
+	// or a Heroku-compatible API. Defaults to heroku.DefaultURL.
+	HerokuURL string
+
+	// If set, called to fetch the bearer token of the Heroku Platform
+	// API instead of using the API key given to NewDynoScaler, e.g. for
+	// a short-lived OAuth token. It is called before the first Heroku
+	// call, and again whenever a call is rejected as unauthorized, which
+	// is then retried once with the new token.
+	TokenProvider func(ctx context.Context) (string, error)
+
+	// How long to sleep between the checks. A shorter one than
+	// MinCheckInterval is raised to it.
 	CheckInterval time.Duration
 
+	// Longest a single check may take. A check still running by then
+	// is abandoned with a warning, and its remaining Heroku calls fail,
+	// so that slow APIs don't make the checks overlap and drift. Zero
+	// means the checks may take as long as they need.
+	CycleTimeout time.Duration
+
+	// How long the Heroku formations listed during a check are reused
+	// by it, so that a check dragged out by retries and backoff doesn't
+	// scale on stale quantities. Older ones are listed again. Zero
+	// means they are reused for the whole check.
+	FormationMaxAge time.Duration
+
+	// The longest to sleep between the checks while the RabbitMQ
+	// queues can't be listed. Each consecutive failure doubles the
+	// time slept, starting from CheckInterval, until MaxBackoff is
+	// reached. The first successful check resets it to CheckInterval.
+	MaxBackoff time.Duration
+
+	// Number of consecutive failed checks after which Monitor gives up
+	// and returns the error of the last one, e.g. for a supervisor to
+	// restart the process. Zero means Monitor never gives up.
+	MaxConsecutiveFailures int
+
+	// How many times to retry a failed Heroku formation update
+	// before giving up until the next check. The retries back off
+	// exponentially, starting from a second. When several worker types
+	// of an app are scaled with a single batch update and it fails,
+	// they are updated one by one instead, with the retries.
+	ScaleRetries int
+
+	// When true, the scaling decisions are logged as usual, but
+	// the Heroku formation is never actually updated.
+	DryRun bool
+
+	// Number of worker configs to check and scale concurrently during
+	// a check, which speeds up the checks with many worker configs.
+	// BeforeScale may be called concurrently then, and a custom Scaler
+	// must be safe for concurrent use. Zero or one checks the worker
+	// configs one at a time.
+	Concurrency int
+
+	// When true, a worker type isn't scaled up while at least half
+	// of its dynos are crashed or still starting, so that crashing
+	// workers don't keep the queue full and balloon the formation.
+	// Only supported by the default Heroku Scaler.
+	CrashGuard bool
+
+	// When true, no worker type is scaled up while a node of a
+	// RabbitMQ cluster has a memory or disk alarm active, as more
+	// consumers would only put more pressure on the broker. Scaling
+	// down is not affected. The nodes are listed through the RabbitMQ
+	// Management API, even with a QueueSource.
+	HaltScaleUpOnBrokerAlarm bool
+
+	// If set, a ScalingEvent is sent on the channel after each
+	// worker config has been checked. The sends never block, so
+	// events are dropped while the channel is full.
+	Events chan ScalingEvent
+
+	// If set, a JSON description of each scaling is POSTed to the URL
+	// once the Heroku formation has been updated. The POSTs are best
+	// effort: they are sent in the background and time out after five
+	// seconds, and failures are only logged.
+	WebhookURL string
+
+	// If set, each scaling is posted to the Slack incoming webhook at
+	// the URL as well, as a message like ":arrow_up: scaled worker 2→5
+	// (queue: 30 msgs)". It is just as best effort as the WebhookURL.
+	SlackWebhookURL string
+
+	// If set, called before the dynos of a worker are scaled from
+	// one quantity to another. Returning an error aborts the scaling.
+	// It is called while the check holds the worker configs, so it
+	// must not call back into the DynoScaler, e.g. Snapshot or
+	// UpdateConfigs, which may deadlock.
+	BeforeScale func(wc WorkerConfig, from, to int) error
+
+	// If set, called before the dynos of a worker are scaled down,
+	// e.g. to keep them while an external system knows more work is
+	// coming. Returning false holds the current quantity. Scaling up
+	// is not affected. Just like BeforeScale, it must not call back
+	// into the DynoScaler.
+	AllowScaleDown func(wc WorkerConfig) bool
+
+	// If set, called after the dynos of a worker have been scaled,
+	// with the error of the Heroku formation update if it failed.
+	// Just like BeforeScale, it must not call back into the DynoScaler.
+	AfterScale func(wc WorkerConfig, from, to int, err error)
+
+	// How long to wait after scaling down a worker type before
+	// it may be scaled down again. Scaling up is not affected.
+	// Zero disables the cooldown.
+	ScaleDownCooldown time.Duration
+
+	// How long to wait after scaling up a worker type before
+	// it may be scaled up again, giving Heroku time to boot the
+	// requested dynos. Scaling down is not affected.
+	// Zero disables the cooldown.
+	ScaleUpCooldown time.Duration
+
+	// Longest to wait before the first check of Monitor. The actual
+	// wait is random, so that several instances deployed at the same
+	// time don't all call RabbitMQ and Heroku at the same instant.
+	// Zero means the first check happens right away.
+	StartupJitter time.Duration
+
+	// How long the checks only observe after the scaler was started or
+	// a new release of the Heroku app was created, e.g. by a deploy,
+	// while the dyno counts and queues are in flux. The checks still
+	// update the metrics and Snapshot, but hold any scaling. The
+	// releases aren't listed with a custom Scaler. Zero scales right
+	// away.
+	PostDeployGrace time.Duration
+
+	// How recently a check must have succeeded for the health endpoint
+	// of Handler to report the scaler as healthy. Zero means three times
+	// the CheckInterval.
+	HealthThreshold time.Duration
+
+	// Sanity ceiling on the quantity of any worker type, which guards
+	// against a runaway queue with aggressive ratios scaling up to an
+	// absurd number of dynos. Unlike the MaxWorkers of the worker configs
+	// it applies to all of them, and a warning is logged whenever it is
+	// hit. NewDynoScaler sets it to 1000, zero means there is no ceiling.
+	WorkerCeiling int
+
+	// Maximum number of dynos to run across all of the worker configs
+	// combined. When the quantities decided during a check add up to
+	// more, they are reduced, starting with the lowest Priority of the
+	// worker configs. The worker configs with the same Priority are
+	// reduced proportionally. This may scale down workers which still
+	// have messages. The worker configs which aren't part of the check,
+	// e.g. due to a different CheckInterval, count with their quantity
+	// as of their last check. Zero means there is no limit.
+	MaxTotalWorkers int
+
 	// Where to log errors.
 	Logger *logrus.Logger
 }
 
 // NewDynoScaler initializes a new DynoScaler with specified and default values.
 // It will connect to the RabbitMQ Management API with TLS using the provided
-// information to get current details about the queues. It also utilizes the
-// Heroku Platform API to get the current formation for the specified app, and
-// to update the formation (scale) to the desired quantity based on the total
-// number of unacked and queued messages.
+// information to get current details about the queues. To connect without
+// TLS, include the scheme in the host, e.g. "http://localhost:15672". It also
+// utilizes the Heroku Platform API to get the current formation for the
+// specified app, and to update the formation (scale) to the desired quantity
+// based on the total number of unacked and queued messages. The worker configs
+// are passed as options, together with any of the other options such as
+// WithLogLevel, and a slice of them with WithWorkerConfigs.
 func NewDynoScaler(
 	rabbitMQHost,
 	rabbitMQUsername,
 	rabbitMQPassword,
 	herokuAPIKey,
 	herokuAppID string,
-	workerConfigs ...WorkerConfig,
+	opts ...Option,
 ) DynoScaler {
 	logger := logrus.New()
-	logger.SetLevel(logrus.PanicLevel)
 
-	return DynoScaler{
+	ds := DynoScaler{
 		rabbitMQHost:     rabbitMQHost,
 		rabbitMQUsername: rabbitMQUsername,
 		rabbitMQPassword: rabbitMQPassword,
 		herokuAPIKey:     herokuAPIKey,
 		herokuAppID:      herokuAppID,
-		workerConfigs:    workerConfigs,
 		log:              logger.WithField("pkg", "dynoscaler"),
+		state:            newScalingState(),
+		now:              time.Now,
+		randInt63n:       rand.Int63n,
+		retryDelay:       time.Second,
+		minInterval:      MinCheckInterval,
 		CheckInterval:    10 * time.Second,
+		MaxBackoff:       5 * time.Minute,
+		WorkerCeiling:    1000,
 		Logger:           logger,
 	}
+
+	for _, opt := range opts {
+		opt.configure(&ds)
+	}
+
+	// a negative one is left to ValidateConfig to reject
+	if ds.CheckInterval >= 0 && ds.CheckInterval < MinCheckInterval {
+		ds.log.WithFields(logrus.Fields{
+			"check_interval":     ds.CheckInterval,
+			"min_check_interval": MinCheckInterval,
+		}).Warn("raising CheckInterval to MinCheckInterval")
+		ds.CheckInterval = MinCheckInterval
+	}
+
+	return ds
 }
 
 // Monitor watches the queue message count and scales the dynos accordingly.
+// It keeps monitoring until the checks have failed MaxConsecutiveFailures
+// times in a row, if set, or until Stop is called.
 func (ds *DynoScaler) Monitor() error {
-	heroku.DefaultTransport.BearerToken = ds.herokuAPIKey
-	hs := heroku.NewService(heroku.DefaultClient)
+	return ds.MonitorContext(context.Background())
+}
 
-	rmqc, err := rabbithole.NewClient("https://"+ds.rabbitMQHost, ds.rabbitMQUsername, ds.rabbitMQPassword)
-	if err != nil {
-		return errors.Wrap(err, "failed to initialize rabbithole client")
+// MonitorContext works just like Monitor, but stops monitoring and
+// returns ctx.Err() as soon as the context is cancelled. It returns
+// nil once Stop is called, and may be called again afterwards.
+func (ds *DynoScaler) MonitorContext(ctx context.Context) error {
+	if err := ds.ValidateConfig(); err != nil {
+		return errors.Wrap(err, "invalid config")
 	}
 
-	// make sure auth works and app exists
-	_, err = hs.DynoList(context.TODO(), ds.herokuAppID, nil)
-	if err != nil {
-		return errors.Wrap(err, "failed to verify Heroku app exists")
+	if err := ds.initClients(); err != nil {
+		return err
+	}
+
+	ds.loadState()
+	ds.started()
+
+	run := &monitorRun{stop: make(chan struct{}), reload: make(chan struct{}, 1)}
+	ds.state.mu.Lock()
+	ds.state.run = run
+	ds.state.mu.Unlock()
+
+	if delay := ds.startupDelay(); delay > 0 {
+		ds.log.WithField("delay", delay).Info("waiting before the first check")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-run.stop:
+			return nil
+		case <-time.After(delay):
+		}
+	}
+
+	if err := ds.verifyHeroku(ctx); err != nil {
+		return err
 	}
 
 	ds.log.Info("starting monitoring")
 
 	for {
-		queues, err := rmqc.ListQueues()
-		if err != nil {
-			ds.log.WithError(err).Error("failed to list queues")
-			time.Sleep(ds.CheckInterval)
-			continue
+		reload, err := ds.monitorIntervals(ctx, run)
+		if !reload {
+			return err
+		}
+
+		ds.log.Info("worker configs updated, restarting monitoring")
+	}
+}
+
+// monitorIntervals monitors the worker configs of each check interval
+// in a goroutine of its own, so that they share the calls to the APIs.
+// It returns once one of them gives up, or the run is stopped, and
+// reports whether it returned because the worker configs were updated.
+func (ds *DynoScaler) monitorIntervals(ctx context.Context, run *monitorRun) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	intervals := ds.intervals()
+	errc := make(chan error, len(intervals))
+
+	for _, interval := range intervals {
+		go func(interval time.Duration) {
+			errc <- ds.monitorConfigs(ctx, interval)
+		}(interval)
+	}
+
+	// stop the other goroutines as soon as one of them gives up
+	var err error
+	reload := false
+	pending := len(intervals)
+
+	select {
+	case err = <-errc:
+		pending--
+	case <-run.stop:
+		ds.log.Info("stopping monitoring")
+	case <-run.reload:
+		reload = true
+	}
+
+	cancel()
+
+	for ; pending > 0; pending-- {
+		<-errc
+	}
+
+	return reload, err
+}
+
+// UpdateConfigs replaces all of the worker configs, e.g. to pick up a
+// changed queue topology without restarting Monitor. It waits for a
+// running check to finish, and the next check uses the new worker
+// configs. The cooldowns and the other state of the worker types
+// which are no longer configured are forgotten, while the ones which
+// are still configured keep theirs. The worker configs aren't
+// validated, so call ValidateConfig afterwards to catch mistakes.
+// Calling it from BeforeScale, AllowScaleDown or AfterScale deadlocks,
+// as the check they are called by never finishes.
+func (ds *DynoScaler) UpdateConfigs(cfgs ...WorkerConfig) {
+	ds.state.configs.Lock()
+	defer ds.state.configs.Unlock()
+
+	old := ds.workerConfigs
+	ds.workerConfigs = append([]WorkerConfig(nil), cfgs...)
+
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	keys := make(map[workerKey]bool)
+	for _, wc := range ds.workerConfigs {
+		keys[workerKey{app: ds.appOf(wc), workerType: wc.WorkerType}] = true
+	}
+
+	for key := range ds.state.workers {
+		if !keys[key] {
+			delete(ds.state.workers, key)
+		}
+	}
+
+	// the statuses are by index, which may have changed
+	statuses := make(map[workerKey]WorkerStatus)
+	for i, status := range ds.state.statuses {
+		if i < len(old) {
+			statuses[workerKey{app: ds.appOf(old[i]), workerType: old[i].WorkerType}] = status
+		}
+	}
+
+	ds.state.statuses = make(map[int]WorkerStatus)
+	for i, wc := range ds.workerConfigs {
+		if status, ok := statuses[workerKey{app: ds.appOf(wc), workerType: wc.WorkerType}]; ok {
+			ds.state.statuses[i] = status
+		}
+	}
+
+	if ds.state.run != nil {
+		select {
+		case ds.state.run.reload <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Stop makes the current Monitor or MonitorContext call return nil,
+// once its goroutines have exited. It does nothing if the scaler isn't
+// monitoring, and may be called more than once.
+func (ds *DynoScaler) Stop() {
+	ds.state.mu.Lock()
+	run := ds.state.run
+	ds.state.mu.Unlock()
+
+	if run != nil {
+		run.stopRun()
+	}
+}
+
+// Pause stops the scaling until Resume is called, e.g. during a
+// maintenance window, without stopping the monitoring. The checks keep
+// evaluating and logging the worker configs while paused, but never
+// update the Heroku formation. It is safe to call at any time.
+func (ds *DynoScaler) Pause() {
+	ds.state.mu.Lock()
+	ds.state.paused = true
+	ds.state.mu.Unlock()
+
+	ds.log.Info("scaling paused")
+}
+
+// Resume resumes the scaling after Pause, from the next check on.
+func (ds *DynoScaler) Resume() {
+	ds.state.mu.Lock()
+	ds.state.paused = false
+	ds.state.mu.Unlock()
+
+	ds.log.Info("scaling resumed")
+}
+
+// paused reports whether the scaling is paused.
+func (ds *DynoScaler) paused() bool {
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	return ds.state.paused
+}
+
+// monitorConfigs checks the worker configs with the given check
+// interval every interval until ctx is done.
+func (ds *DynoScaler) monitorConfigs(ctx context.Context, interval time.Duration) error {
+	failures := 0
+	matches := func(wc WorkerConfig) bool {
+		return ds.intervalOf(wc) == interval
+	}
+
+	for {
+		// failures are already logged, the next check will try again
+		if err := ds.checkWhere(ctx, matches); err != nil {
+			failures++
+
+			if ds.MaxConsecutiveFailures > 0 && failures >= ds.MaxConsecutiveFailures {
+				return errors.Wrapf(err, "giving up after %d consecutive failed checks", failures)
+			}
+		} else {
+			failures = 0
+		}
+
+		if err := sleep(ctx, ds.nextInterval(interval)); err != nil {
+			return err
+		}
+	}
+}
+
+// intervals returns the check intervals of the worker configs, in
+// ascending order. There is always at least one interval, so that
+// the queues are monitored even without any worker configs.
+func (ds *DynoScaler) intervals() []time.Duration {
+	ds.state.configs.RLock()
+	defer ds.state.configs.RUnlock()
+
+	seen := make(map[time.Duration]bool)
+	var intervals []time.Duration
+
+	for _, wc := range ds.workerConfigs {
+		interval := ds.intervalOf(wc)
+		if !seen[interval] {
+			seen[interval] = true
+			intervals = append(intervals, interval)
 		}
+	}
+
+	if len(intervals) == 0 {
+		intervals = append(intervals, ds.intervalOf(WorkerConfig{}))
+	}
+
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i] < intervals[j]
+	})
+
+	return intervals
+}
+
+// intervalOf returns the check interval of wc, raised to
+// MinCheckInterval if shorter, also when it was set on the worker
+// config or changed on the DynoScaler after NewDynoScaler.
+func (ds *DynoScaler) intervalOf(wc WorkerConfig) time.Duration {
+	interval := ds.CheckInterval
+	if wc.CheckInterval > 0 {
+		interval = wc.CheckInterval
+	}
+
+	if interval < ds.minInterval {
+		return ds.minInterval
+	}
+
+	return interval
+}
+
+// CheckOnce lists the queues and formations once and scales the
+// dynos of every worker config accordingly, then returns. It is
+// meant for running the checks from an external scheduler instead
+// of using Monitor. A failing worker config does not prevent the
+// remaining ones from being checked; all of the failures are
+// combined into the returned error. The API clients are created
+// by the first call and reused by the later ones, so the same
+// DynoScaler should be used for all of the checks.
+func (ds *DynoScaler) CheckOnce(ctx context.Context) error {
+	if err := ds.initClients(); err != nil {
+		return err
+	}
+
+	ds.loadState()
+
+	return ds.check(ctx)
+}
+
+// Verify checks that the Heroku API key works and the app exists, and
+// that the RabbitMQ Management API is reachable with the credentials,
+// without scaling anything. It can be used to fail fast at startup,
+// e.g. in a health check, before calling Monitor. It returns as soon
+// as ctx is done, so a deadline keeps a hung API from blocking it.
+func (ds *DynoScaler) Verify(ctx context.Context) error {
+	if err := ds.initClients(); err != nil {
+		return err
+	}
+
+	if err := ds.verifyHeroku(ctx); err != nil {
+		return err
+	}
 
-		formationList, err := hs.FormationList(context.TODO(), ds.herokuAppID, nil)
+	// the RabbitMQ client doesn't support contexts
+	for _, name := range ds.allClusterNames() {
+		name := name
+		err := withContext(ctx, func() error {
+			_, err := ds.listQueues(name)
+			return err
+		})
 		if err != nil {
-			ds.log.WithError(err).Error("failed to list formations")
-			time.Sleep(ds.CheckInterval)
+			return errors.Wrap(err, "failed to verify RabbitMQ is reachable")
+		}
+	}
+
+	return nil
+}
+
+// withContext calls fn, but returns ctx.Err() as soon as ctx is done,
+// for the calls which don't support a context themselves. fn keeps on
+// running in the background until it returns then.
+func withContext(ctx context.Context, fn func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- fn()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// verifyHeroku makes sure auth works and the apps exist, unless a
+// custom Scaler is used.
+func (ds *DynoScaler) verifyHeroku(ctx context.Context) error {
+	if ds.Scaler != nil {
+		return nil
+	}
+
+	verified := make(map[string]bool)
+
+	for _, app := range ds.apps() {
+		if verified[app] {
 			continue
 		}
 
-		for _, wc := range ds.workerConfigs {
-			newQuantity, scale, err := ds.checkScaling(wc, queues, formationList)
-			if err != nil {
-				ds.log.WithError(err).WithFields(logrus.Fields{
-					"heroku_app":  ds.herokuAppID,
-					"worker_type": wc.WorkerType,
-				}).Error("failed to check whether to scale or not")
-				time.Sleep(ds.CheckInterval)
-				continue
-			}
+		if _, err := ds.hs.DynoList(ctx, app, nil); err != nil {
+			return errors.Wrap(err, "failed to verify Heroku app exists")
+		}
 
-			if scale {
-				ds.log.WithFields(logrus.Fields{
-					"heroku_app":   ds.herokuAppID,
-					"worker_type":  wc.WorkerType,
-					"new_quantity": newQuantity,
-				}).Info("scaling dynos")
-
-				err := scaleDynos(hs, ds.herokuAppID, wc.WorkerType, newQuantity)
-				if err != nil {
-					ds.log.WithError(err).Error("failed to update Heroku formation")
-					time.Sleep(ds.CheckInterval)
-					continue
-				}
+		verified[app] = true
+	}
+
+	return nil
+}
+
+// apps returns the Heroku apps of all of the worker configs,
+// as well as the app of the DynoScaler.
+func (ds *DynoScaler) apps() []string {
+	ds.state.configs.RLock()
+	defer ds.state.configs.RUnlock()
+
+	apps := []string{ds.herokuAppID}
+	for _, wc := range ds.workerConfigs {
+		apps = append(apps, ds.appOf(wc))
+	}
+
+	return apps
+}
+
+// appOf returns the Heroku app the dynos of wc run in.
+func (ds *DynoScaler) appOf(wc WorkerConfig) string {
+	if wc.HerokuAppID != "" {
+		return wc.HerokuAppID
+	}
+
+	return ds.herokuAppID
+}
+
+// initClients initializes the Heroku and RabbitMQ API clients,
+// unless they have already been set. The clients are stored on the
+// DynoScaler, so they are only created once.
+func (ds *DynoScaler) initClients() error {
+	if ds.hs == nil {
+		transport := &heroku.Transport{BearerToken: ds.herokuAPIKey}
+		if ds.TokenProvider != nil {
+			transport = &heroku.Transport{
+				Transport: &tokenTransport{provider: ds.TokenProvider},
 			}
 		}
 
-		time.Sleep(ds.CheckInterval)
+		hs := heroku.NewService(&http.Client{
+			Transport: &rateLimitTransport{base: transport, observe: ds.observeRateLimitRemaining},
+		})
+
+		if ds.HerokuURL != "" {
+			hs.URL = ds.HerokuURL
+		}
+
+		ds.hs = hs
+	}
+
+	if ds.rmqc == nil {
+		rmqc, err := ds.newRabbitClient(ds.rabbitMQHost, ds.rabbitMQUsername, ds.rabbitMQPassword)
+		if err != nil {
+			return err
+		}
+
+		ds.rmqc = rmqc
+	}
+
+	for name, c := range ds.clusters {
+		if c.client != nil {
+			continue
+		}
+
+		client, err := ds.newRabbitClient(c.host, c.username, c.password)
+		if err != nil {
+			return errors.Wrapf(err, "RabbitMQ cluster %s", name)
+		}
+
+		c.client = client
 	}
+
+	return nil
 }
 
-// scaleDynos scales herokuAppName's process with the name workerType (name that is
-// used in the Procfile) to the number of dynos specified by quantity.
-func scaleDynos(hs *heroku.Service, herokuAppName, workerType string, quantity int) error {
-	_, err := hs.FormationUpdate(
-		context.TODO(),
-		herokuAppName,
-		workerType,
-		heroku.FormationUpdateOpts{Quantity: &quantity},
-	)
+// newRabbitClient returns a client of the RabbitMQ Management API
+// at host.
+func (ds *DynoScaler) newRabbitClient(host, username, password string) (rabbitClient, error) {
+	rmqc, err := rabbithole.NewClient(ds.managementURL(host), username, password)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize rabbithole client")
+	}
 
-	return err
+	if ds.RabbitMQTransport != nil {
+		rmqc.SetTransport(ds.RabbitMQTransport)
+	}
+
+	rmqc.SetTimeout(ds.RabbitMQTimeout)
+	return rmqc, nil
 }
 
-// maxWorkerCount returns the number of workers that should
-// be used according to the ratio map and the current message count.
-func maxWorkerCount(ratioMap map[int]int, curMsgCount int) int {
-	// don't rely on golang random map order
-	keys := make([]int, len(ratioMap))
-	i := 0
-	for k := range ratioMap {
-		keys[i] = k
-		i++
+// listQueues lists the queues of the Vhost, or of all vhosts if unset,
+// in the RabbitMQ cluster with the given name.
+func (ds *DynoScaler) listQueues(cluster string) ([]rabbithole.QueueInfo, error) {
+	defer ds.observeCall("ListQueues", time.Now())
+
+	if ds.QueueSource != nil && cluster == "" {
+		queues, err := ds.QueueSource.ListQueues()
+		if err != nil || ds.Vhost == "" {
+			return queues, err
+		}
+
+		var inVhost []rabbithole.QueueInfo
+		for _, q := range queues {
+			if q.Vhost == ds.Vhost {
+				inVhost = append(inVhost, q)
+			}
+		}
+
+		return inVhost, nil
 	}
-	sort.Ints(keys)
 
-	max := 0
+	c, err := ds.cluster(cluster)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, msgCount := range keys {
-		if curMsgCount >= msgCount {
-			max = ratioMap[msgCount]
-		} else {
+	var queues []rabbithole.QueueInfo
+	if ds.Vhost != "" {
+		queues, err = c.client.ListQueuesIn(ds.Vhost)
+	} else {
+		queues, err = c.client.ListQueues()
+	}
+
+	if err != nil && cluster != "" {
+		return nil, errors.Wrapf(err, "RabbitMQ cluster %s", cluster)
+	}
+
+	return queues, err
+}
+
+// lookupQueues lists the queues of the RabbitMQ clusters of the worker
+// configs with the given indexes, by the name of the cluster, and lists
+// them again up to QueueLookupRetries times while a queue of the worker
+// configs is missing.
+func (ds *DynoScaler) lookupQueues(ctx context.Context, configs []int) (map[string][]rabbithole.QueueInfo, error) {
+	clusters := ds.clusterNames(configs)
+	queues, err := ds.listClusters(ctx, clusters)
+
+	for attempt := 1; err == nil && attempt <= ds.QueueLookupRetries; attempt++ {
+		if !ds.missingQueue(configs, queues) {
 			break
 		}
+
+		ds.log.WithField("attempt", attempt).Warn("queue missing from RabbitMQ data, listing the queues again")
+		queues, err = ds.listClusters(ctx, clusters)
 	}
 
-	return max
+	return queues, err
 }
 
-// checkScaling checks whether the worker should be scaled and what it should be scaled to.
-func (ds *DynoScaler) checkScaling(
-	qc WorkerConfig,
-	queues []rabbithole.QueueInfo,
-	formations []heroku.Formation,
-) (newQuantity int, scale bool, err error) {
+// listClusters lists the queues of the RabbitMQ clusters with the given
+// names, by the name of the cluster.
+func (ds *DynoScaler) listClusters(ctx context.Context, clusters []string) (map[string][]rabbithole.QueueInfo, error) {
+	queues := make(map[string][]rabbithole.QueueInfo, len(clusters))
 
-	var qInfo *rabbithole.QueueInfo
-	for _, qi := range queues {
-		if qi.Name == qc.QueueName {
-			qInfo = &qi
-			break
+	for _, name := range clusters {
+		qs, err := ds.listQueuesContext(ctx, name)
+		if err != nil {
+			return nil, err
 		}
+
+		queues[name] = qs
 	}
 
-	if qInfo == nil {
-		return 0, false, errors.New("unable to find queue info from RabbitMQ data")
+	return queues, nil
+}
+
+// listQueuesContext does the work of listQueues, but returns as soon as
+// ctx is done.
+func (ds *DynoScaler) listQueuesContext(ctx context.Context, cluster string) ([]rabbithole.QueueInfo, error) {
+	// the RabbitMQ client doesn't support contexts, and queues is only
+	// read once the listing has returned
+	var queues []rabbithole.QueueInfo
+	err := withContext(ctx, func() error {
+		var err error
+		queues, err = ds.listQueues(cluster)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	var formation *heroku.Formation
-	for _, f := range formations {
-		if f.Type == qc.WorkerType {
-			formation = &f
-			break
+	return queues, nil
+}
+
+// missingQueue reports whether a queue of the worker configs with the
+// given indexes is missing from queues, by the name of the cluster.
+func (ds *DynoScaler) missingQueue(configs []int, queues map[string][]rabbithole.QueueInfo) bool {
+	for _, i := range configs {
+		wc := ds.workerConfigs[i]
+
+		var missing *QueueNotFoundError
+		if _, err := combinedQueueInfo(wc, queues[wc.RabbitMQCluster]); errors.As(err, &missing) && missing.Queue != "" {
+			return true
 		}
 	}
 
-	if formation == nil {
-		return 0, false, errors.New("unable to find formation info from Heroku data")
-	}
+	return false
+}
+
+// check performs a single check of all worker configs.
+func (ds *DynoScaler) check(ctx context.Context) error {
+	return ds.checkWhere(ctx, func(WorkerConfig) bool { return true })
+}
 
-	totalMsgs := qInfo.MessagesUnacknowledged + qInfo.Messages
+// checkWhere performs a single check of the worker configs matched by
+// matches. UpdateConfigs waits for the check to finish.
+func (ds *DynoScaler) checkWhere(ctx context.Context, matches func(WorkerConfig) bool) error {
+	ds.state.configs.RLock()
+	defer ds.state.configs.RUnlock()
 
-	if totalMsgs > 0 {
-		desiredQuantity := maxWorkerCount(qc.MsgWorkerRatios, totalMsgs)
-		if formation.Quantity < desiredQuantity {
-			scale = true
-			newQuantity = desiredQuantity
+	var configs []int
+	for i, wc := range ds.workerConfigs {
+		if matches(wc) {
+			configs = append(configs, i)
 		}
-	} else if formation.Quantity > 0 {
-		scale = true
-		newQuantity = 0
 	}
 
-	return newQuantity, scale, nil
+	return ds.checkConfigs(ctx, configs)
+}
+
+// checkConfigs performs a single check of the worker configs with
+// the given indexes, and records its outcome.
+func (ds *DynoScaler) checkConfigs(ctx context.Context, configs []int) error {
+	if ds.CycleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ds.CycleTimeout)
+		defer cancel()
+	}
+
+	err := ds.checkGroup(ctx, configs)
+	if err != nil && ds.CycleTimeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		ds.log.WithField("cycle_timeout", ds.CycleTimeout).Warn("check exceeded CycleTimeout, abandoning it")
+		err = errors.Wrapf(err, "check exceeded CycleTimeout of %s", ds.CycleTimeout)
+	}
+
+	ds.state.mu.Lock()
+	if err != nil {
+		ds.state.lastError = err
+		ds.state.lastErrorTime = ds.now()
+	} else {
+		ds.state.lastSuccess = ds.now()
+	}
+	ds.state.mu.Unlock()
+
+	return err
+}
+
+// checkGroup does the work of checkConfigs.
+func (ds *DynoScaler) checkGroup(ctx context.Context, configs []int) error {
+	start := ds.now()
+	configs = ds.enabled(configs)
+
+	queues, err := ds.lookupQueues(ctx, configs)
+
+	ds.state.mu.Lock()
+	if err != nil {
+		ds.state.listFailures++
+	} else {
+		ds.state.listFailures = 0
+	}
+	ds.state.mu.Unlock()
+
+	if err != nil {
+		ds.log.WithError(err).Error("failed to list queues")
+		return errors.Wrap(err, "failed to list queues")
+	}
+
+	if wait := ds.rateLimitWait(); wait > 0 {
+		ds.observeQueues(configs, queues, nil)
+		return errors.Errorf("holding off Heroku calls for %s due to rate limiting", wait)
+	}
+
+	scalers := ds.newScalers(configs)
+	evs, checked, results := ds.evaluateConfigs(ctx, scalers, configs, queues, false)
+
+	pending := make([]bool, len(configs))
+	parallel(len(configs), ds.Concurrency, func(j int) {
+		if !checked[j] {
+			return
+		}
+
+		wc := ds.workerConfigs[configs[j]]
+		evs[j] = ds.throttle(wc, evs[j])
+		pending[j] = ds.prepare(wc, evs[j])
+	})
+
+	scaled, scaleErrs := ds.scaleAll(ctx, scalers, configs, evs, pending)
+
+	for j, i := range configs {
+		if !checked[j] {
+			continue
+		}
+
+		if scaleErrs[j] != nil {
+			results[j] = errors.Wrapf(scaleErrs[j], "failed to scale %s", ds.workerConfigs[i].WorkerType)
+		}
+
+		// a scaling which failed or was held back is tried again by
+		// the next check, regardless of the cooldowns
+		if scaled[j] {
+			ds.recordScaling(ds.workerConfigs[i], evs[j])
+		}
+
+		ds.record(i, evs[j], scaled[j])
+	}
+
+	// e.g. while the formations can't be listed
+	ds.observeQueues(configs, queues, checked)
+	ds.saveState()
+
+	var errs multiError
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	ds.logSummary(start, evs, checked, scaled, len(errs))
+
+	return errs.errOrNil()
+}
+
+// logSummary logs a single line about the outcome of a check which
+// started at start, so that the scaling can be followed at Info level
+// without the details of every worker config.
+func (ds *DynoScaler) logSummary(start time.Time, evs []evaluation, checked, scaled []bool, failed int) {
+	evaluated, up, down, held, total := 0, 0, 0, 0, 0
+	for j, ev := range evs {
+		if !checked[j] {
+			continue
+		}
+
+		evaluated++
+		total += ev.totalMsgs
+
+		switch {
+		case !scaled[j]:
+			held++
+		case ev.newQuantity > ev.oldQuantity:
+			up++
+		default:
+			down++
+		}
+	}
+
+	ds.log.WithFields(logrus.Fields{
+		"configs":        evaluated,
+		"scaled_up":      up,
+		"scaled_down":    down,
+		"held":           held,
+		"failed":         failed,
+		"total_messages": total,
+		"duration":       ds.now().Sub(start),
+	}).Info("check completed")
+}
+
+// enabled returns the indexes of configs whose worker configs
+// aren't Disabled.
+func (ds *DynoScaler) enabled(configs []int) []int {
+	var enabled []int
+	for _, i := range configs {
+		wc := ds.workerConfigs[i]
+		if wc.Disabled {
+			ds.log.WithFields(logrus.Fields{
+				"heroku_app":  ds.appOf(wc),
+				"worker_type": wc.WorkerType,
+			}).Debug("worker config is disabled, skipping")
+			continue
+		}
+
+		enabled = append(enabled, i)
+	}
+
+	return enabled
+}
+
+// newScalers returns one scaler per app of the worker configs with the
+// given indexes, so that the formations are listed only once per check.
+func (ds *DynoScaler) newScalers(configs []int) map[string]Scaler {
+	scalers := make(map[string]Scaler)
+	for _, i := range configs {
+		app := ds.appOf(ds.workerConfigs[i])
+		if _, ok := scalers[app]; !ok {
+			scalers[app] = ds.newScaler(app)
+		}
+	}
+
+	return scalers
+}
+
+// evaluateConfigs evaluates the worker configs with the given indexes,
+// limits them to MaxTotalWorkers, holds their scale-ups on a broker
+// alarm and their scalings during the PostDeployGrace, before the
+// cooldowns are applied. While planning, nothing is started or logged
+// above Debug, and AllowScaleDown isn't consulted.
+// It reports which of them were checked, and the error of each.
+func (ds *DynoScaler) evaluateConfigs(
+	ctx context.Context,
+	scalers map[string]Scaler,
+	configs []int,
+	queues map[string][]rabbithole.QueueInfo,
+	planning bool,
+) ([]evaluation, []bool, []error) {
+
+	evs := make([]evaluation, len(configs))
+	checked := make([]bool, len(configs))
+	errs := make([]error, len(configs))
+	parallel(len(configs), ds.Concurrency, func(j int) {
+		wc := ds.workerConfigs[configs[j]]
+		evs[j], checked[j], errs[j] = ds.evaluateConfig(ctx, scalers[ds.appOf(wc)], configs[j], queues)
+	})
+
+	if ds.MaxTotalWorkers > 0 {
+		ds.limitTotal(configs, evs, checked, planning)
+	}
+
+	ds.holdOnBrokerAlarm(ctx, configs, evs, checked)
+	ds.holdDuringGrace(ctx, configs, evs, checked, planning)
+	if !planning {
+		ds.holdVetoedScaleDowns(configs, evs, checked)
+	}
+
+	return evs, checked, errs
+}
+
+// holdVetoedScaleDowns holds the scale-downs of the checked evaluations
+// which AllowScaleDown doesn't allow, if it is set.
+func (ds *DynoScaler) holdVetoedScaleDowns(configs []int, evs []evaluation, checked []bool) {
+	if ds.AllowScaleDown == nil {
+		return
+	}
+
+	for j := range evs {
+		if !checked[j] || evs[j].decision != ScaleDown {
+			continue
+		}
+
+		wc := ds.workerConfigs[configs[j]]
+		if ds.AllowScaleDown(wc) {
+			continue
+		}
+
+		ds.log.WithFields(logrus.Fields{
+			"heroku_app":  ds.appOf(wc),
+			"worker_type": wc.WorkerType,
+		}).Info("scale-down vetoed by AllowScaleDown")
+
+		evs[j].decision = Hold
+		evs[j].newQuantity = evs[j].oldQuantity
+	}
+}
+
+// evaluateConfig works out how to scale the i-th worker config, before
+// the cooldowns are applied. It reports whether the config was checked,
+// which it isn't when its worker type is not in the Heroku formation.
+func (ds *DynoScaler) evaluateConfig(ctx context.Context, sc Scaler, i int, queues map[string][]rabbithole.QueueInfo) (evaluation, bool, error) {
+	wc := ds.workerConfigs[i]
+	app := ds.appOf(wc)
+
+	ev, err := ds.assess(ctx, sc, wc, queues[wc.RabbitMQCluster])
+	if errors.Is(err, ErrFormationNotFound) {
+		// e.g. a new process type which hasn't been deployed yet
+		ds.log.WithFields(logrus.Fields{
+			"heroku_app":  app,
+			"worker_type": wc.WorkerType,
+		}).Warn("worker type not found in Heroku formation, skipping")
+		return evaluation{}, false, nil
+	}
+
+	if err != nil {
+		ds.log.WithError(err).WithFields(logrus.Fields{
+			"heroku_app":  app,
+			"worker_type": wc.WorkerType,
+		}).Error("failed to check whether to scale or not")
+		return evaluation{}, false, errors.Wrapf(err, "failed to check scaling of %s", wc.WorkerType)
+	}
+
+	return ev, true, nil
+}
+
+// record reports the outcome of the check of the i-th worker config
+// through the metrics, its status, the events and the webhook.
+func (ds *DynoScaler) record(i int, ev evaluation, scaled bool) {
+	wc := ds.workerConfigs[i]
+	app := ds.appOf(wc)
+
+	ds.metrics.observe(app, wc, ev, scaled)
+	ds.recordStatus(i, app, wc, ev, scaled)
+
+	event := ScalingEvent{
+		HerokuApp:     app,
+		WorkerType:    wc.WorkerType,
+		QueueName:     ev.queueName,
+		OldQuantity:   ev.oldQuantity,
+		NewQuantity:   ev.newQuantity,
+		TotalMessages: ev.totalMsgs,
+		Time:          ds.now(),
+		Decision:      ev.decision,
+		Scaled:        scaled,
+	}
+
+	ds.emit(event)
+	ds.notifyWebhook(event)
+}
+
+// observeQueues records the backlogs of the worker configs with the
+// given indexes which weren't checked, according to checked, so that
+// the metrics and Snapshot keep up with the queues even while the
+// Heroku API fails. A nil checked observes all of them.
+func (ds *DynoScaler) observeQueues(configs []int, queues map[string][]rabbithole.QueueInfo, checked []bool) {
+	for j, i := range configs {
+		if checked != nil && checked[j] {
+			continue
+		}
+
+		wc := ds.workerConfigs[i]
+		qInfo, err := combinedQueueInfo(wc, queues[wc.RabbitMQCluster])
+		if err != nil {
+			continue
+		}
+
+		app := ds.appOf(wc)
+		n := backlog(wc, qInfo)
+
+		ds.metrics.observeBacklog(app, wc, qInfo.Name, n)
+		ds.recordBacklog(i, app, wc, qInfo.Name, n)
+	}
+}
+
+// parallel calls fn for each of 0 to n-1, with at most concurrency
+// calls running at the same time. A concurrency below two calls fn
+// sequentially, in order.
+func parallel(n, concurrency int, fn func(i int)) {
+	if concurrency < 2 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+
+		return
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+// rabbitMQURL returns the URL of the RabbitMQ Management API. The host
+// is used with https unless it already includes a scheme, which allows
+// e.g. "http://localhost:15672" for a local broker.
+func (ds *DynoScaler) rabbitMQURL() string {
+	return ds.managementURL(ds.rabbitMQHost)
+}
+
+// managementURL returns the URL of the RabbitMQ Management API at host,
+// just like rabbitMQURL.
+func (ds *DynoScaler) managementURL(host string) string {
+	u := host
+	if !strings.Contains(u, "://") {
+		u = "https://" + u
+	}
+
+	if ds.RabbitMQPort != 0 {
+		u = fmt.Sprintf("%s:%d", u, ds.RabbitMQPort)
+	}
+
+	return u
+}
+
+// sleep pauses for the duration d or until ctx is done, whichever
+// happens first. It returns ctx.Err() if the context ended the pause.
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// prepare reports whether the dynos of wc should be scaled as decided
+// by ev, which they aren't if the scaler is paused, in dry run mode or
+// BeforeScale aborts it.
+func (ds *DynoScaler) prepare(wc WorkerConfig, ev evaluation) bool {
+	if !ev.decision.scales() {
+		return false
+	}
+
+	log := ds.log.WithFields(logrus.Fields{
+		"heroku_app":   ds.appOf(wc),
+		"worker_type":  wc.WorkerType,
+		"new_quantity": ev.newQuantity,
+	})
+
+	if ds.paused() {
+		log.Info("scaling is paused, not scaling dynos")
+		return false
+	}
+
+	if ds.DryRun {
+		log.WithField("dry_run", true).Info("dry run, not scaling dynos")
+		return false
+	}
+
+	if ds.BeforeScale != nil {
+		if err := ds.BeforeScale(wc, ev.oldQuantity, ev.newQuantity); err != nil {
+			log.WithError(err).Warn("scaling aborted by BeforeScale")
+			return false
+		}
+	}
+
+	log.Info("scaling dynos")
+	return true
+}
+
+// scale scales the process workerType to quantity dynos, retrying
+// up to ds.ScaleRetries times if the formation update fails. It
+// returns the error of the last attempt if all of them failed. Once
+// the Heroku API rate limit is hit, it gives up without retrying.
+func (ds *DynoScaler) scale(ctx context.Context, sc Scaler, app, workerType string, quantity int) error {
+	var err error
+
+	for attempt := 0; attempt <= ds.ScaleRetries; attempt++ {
+		if attempt > 0 {
+			delay := backoffDelay(ds.retryDelay, ds.CheckInterval, attempt-1, ds.randInt63n)
+
+			ds.log.WithError(err).WithFields(logrus.Fields{
+				"heroku_app":  app,
+				"worker_type": workerType,
+				"attempt":     attempt,
+				"delay":       delay,
+			}).Warn("retrying failed Heroku formation update")
+
+			if err := sleep(ctx, delay); err != nil {
+				return err
+			}
+		}
+
+		if wait := ds.rateLimitWait(); wait > 0 {
+			return errors.Errorf("holding off Heroku calls for %s due to rate limiting", wait)
+		}
+
+		err = sc.SetQuantity(ctx, workerType, quantity)
+		if err == nil {
+			return nil
+		}
+
+		ds.observeHerokuError(err)
+	}
+
+	return err
+}
+
+// scaleDynos scales herokuAppName's process with the name workerType (name that is
+// used in the Procfile) to the number of dynos specified by quantity.
+func scaleDynos(ctx context.Context, hs herokuClient, herokuAppName, workerType string, quantity int) error {
+	_, err := hs.FormationUpdate(
+		ctx,
+		herokuAppName,
+		workerType,
+		heroku.FormationUpdateOpts{Quantity: &quantity},
+	)
+
+	return err
+}
+
+// desiredWorkerCount returns the number of workers qc should be running
+// for the backlog, before applying MinWorkers and MaxWorkers.
+func desiredWorkerCount(qc WorkerConfig, backlog int) int {
+	if qc.RatioMode == RatioLinear {
+		if qc.MessagesPerWorker <= 0 {
+			return 0
+		}
+
+		return qc.RoundingMode.round(float64(backlog) / float64(qc.MessagesPerWorker))
+	}
+
+	if qc.WorkersPerMessage > 0 {
+		return qc.RoundingMode.round(float64(backlog) * qc.WorkersPerMessage)
+	}
+
+	if qc.Interpolate {
+		return interpolatedWorkerCount(qc.MsgWorkerRatios, backlog, qc.RoundingMode)
+	}
+
+	return maxWorkerCount(qc.MsgWorkerRatios, backlog)
+}
+
+// interpolatedWorkerCount returns the number of workers for the
+// curMsgCount interpolated linearly between the adjacent message counts
+// of ratioMap, rounded by mode. Below the lowest message count there
+// are no workers, and from the highest one on its workers are used.
+func interpolatedWorkerCount(ratioMap map[int]int, curMsgCount int, mode RoundingMode) int {
+	keys := sortedKeys(ratioMap)
+
+	for i, msgCount := range keys {
+		if curMsgCount < msgCount {
+			if i == 0 {
+				return 0
+			}
+
+			lowMsgs, lowWorkers := keys[i-1], ratioMap[keys[i-1]]
+			step := float64(ratioMap[msgCount]-lowWorkers) / float64(msgCount-lowMsgs)
+
+			return mode.round(float64(lowWorkers) + step*float64(curMsgCount-lowMsgs))
+		}
+	}
+
+	if len(keys) == 0 {
+		return 0
+	}
+
+	return ratioMap[keys[len(keys)-1]]
+}
+
+// maxWorkerCount returns the number of workers that should
+// be used according to the ratio map and the current message count.
+func maxWorkerCount(ratioMap map[int]int, curMsgCount int) int {
+	max := 0
+
+	for _, msgCount := range sortedKeys(ratioMap) {
+		if curMsgCount >= msgCount {
+			max = ratioMap[msgCount]
+		} else {
+			break
+		}
+	}
+
+	return max
+}
+
+// combinedWorkerCount returns the number of workers for the depth and
+// the publish rate of the queue combined by the ThresholdPolicy of qc,
+// which is the larger of the worker counts of the signals reaching their
+// thresholds. It also reports whether the signals are below their
+// thresholds as a whole, in which case the workers shouldn't be scaled up.
+func combinedWorkerCount(qc WorkerConfig, qInfo rabbithole.QueueInfo) (int, bool) {
+	byDepth, byRate := qc, qc
+	byDepth.ThresholdPolicy, byDepth.RatioMode = ThresholdNone, RatioByDepth
+	byRate.ThresholdPolicy, byRate.RatioMode = ThresholdNone, RatioByPublishRate
+
+	depth := backlog(byDepth, qInfo)
+	rate := backlog(byRate, qInfo)
+
+	depthReached := depth > 0 && depth >= qc.ScaleUpThreshold
+	rateReached := rate > 0 && qInfo.MessageStats.PublishDetails.Rate >= float32(qc.RateThreshold)
+
+	workers := 0
+	if depthReached {
+		workers = desiredWorkerCount(byDepth, depth)
+	}
+
+	if n := desiredWorkerCount(byRate, rate); rateReached && n > workers {
+		workers = n
+	}
+
+	if qc.ThresholdPolicy == ThresholdAnd {
+		return workers, !(depthReached && rateReached)
+	}
+
+	return workers, !(depthReached || rateReached)
+}
+
+// sortedKeys returns the message counts of ratioMap in ascending
+// order, so that nothing relies on golang random map order.
+func sortedKeys(ratioMap map[int]int) []int {
+	keys := make([]int, 0, len(ratioMap))
+	for k := range ratioMap {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	return keys
+}
+
+// combinedQueueInfo returns the info of the queues tracked by qc. When
+// qc tracks several queues, their message counts, publish rates and
+// consumers are summed up.
+func combinedQueueInfo(qc WorkerConfig, queues []rabbithole.QueueInfo) (rabbithole.QueueInfo, error) {
+	names := qc.queueNames()
+	combined := rabbithole.QueueInfo{Name: strings.Join(names, ",")}
+
+	if len(names) == 0 && qc.QueueNamePattern == "" {
+		return combined, &QueueNotFoundError{}
+	}
+
+	counted := make(map[string]bool)
+	idle := true
+	add := func(qi rabbithole.QueueInfo) {
+		if qi.Status != queueIdle {
+			idle = false
+		}
+
+		combined.Messages += qi.Messages
+		combined.MessagesUnacknowledged += qi.MessagesUnacknowledged
+		combined.Consumers += qi.Consumers
+		combined.MessageStats.PublishDetails.Rate += qi.MessageStats.PublishDetails.Rate
+		counted[qi.Name] = true
+	}
+
+	for _, name := range names {
+		found := false
+
+		for _, qi := range queues {
+			if qi.Name != name {
+				continue
+			}
+
+			add(qi)
+			found = true
+			break
+		}
+
+		if !found && !qc.TreatMissingQueueAsEmpty {
+			return combined, &QueueNotFoundError{Queue: name}
+		}
+	}
+
+	if qc.QueueNamePattern != "" {
+		re, err := regexp.Compile(qc.QueueNamePattern)
+		if err != nil {
+			return combined, errors.Wrap(err, "invalid queue name pattern")
+		}
+
+		for _, qi := range queues {
+			if !counted[qi.Name] && re.MatchString(qi.Name) {
+				add(qi)
+			}
+		}
+	}
+
+	// the combined queue is only idle if all of its queues are
+	if idle && len(counted) > 0 {
+		combined.Status = queueIdle
+	}
+
+	return combined, nil
+}
+
+// backlog returns the value that the MsgWorkerRatios of qc
+// are compared against, according to its RatioMode.
+func backlog(qc WorkerConfig, qInfo rabbithole.QueueInfo) int {
+	var n float64
+
+	switch {
+	case qc.RatioMode == RatioByPublishRate && qc.ThresholdPolicy == ThresholdNone:
+		n = float64(qInfo.MessageStats.PublishDetails.Rate)
+	case qc.RatioMode == RatioByUnacked && qc.ThresholdPolicy == ThresholdNone:
+		n = float64(qInfo.MessagesUnacknowledged)
+	case qc.BacklogFunc != nil:
+		n = float64(qc.BacklogFunc(qInfo))
+	default:
+		n = float64(qInfo.MessagesUnacknowledged + qInfo.Messages)
+	}
+
+	if qc.ConsumerAware && qInfo.Consumers > 1 {
+		n /= float64(qInfo.Consumers)
+	}
+
+	return int(math.Ceil(n))
+}
+
+// evaluation is the outcome of checking a single worker config.
+type evaluation struct {
+	queueName string
+	totalMsgs int
+
+	// the backlog of this check alone, which totalMsgs averages with
+	// the previous ones when the worker config has a SmoothingWindow
+	sample int
+
+	oldQuantity int
+	newQuantity int
+	decision    Decision
+}
+
+// assess evaluates qc using the current quantity of sc, before the
+// cooldowns are applied.
+func (ds *DynoScaler) assess(
+	ctx context.Context,
+	sc Scaler,
+	qc WorkerConfig,
+	queues []rabbithole.QueueInfo,
+) (evaluation, error) {
+
+	qInfo, err := combinedQueueInfo(qc, queues)
+	if err != nil {
+		return evaluation{}, err
+	}
+
+	current, err := sc.CurrentQuantity(ctx, qc.WorkerType)
+	if errors.Is(err, ErrFormationNotFound) && qc.AssumeZeroWhenFormationMissing {
+		current, err = 0, nil
+	}
+
+	if err != nil {
+		ds.observeHerokuError(err)
+		return evaluation{}, err
+	}
+
+	ev := ds.capped(qc, qInfo, current, ds.stale(ctx, qc, queues))
+
+	// ValidateConfig rejects this, but CheckOnce doesn't validate
+	if ev.totalMsgs > 0 && qc.RatioMode != RatioLinear && qc.WorkersPerMessage == 0 && len(qc.MsgWorkerRatios) == 0 {
+		ds.log.WithFields(logrus.Fields{
+			"heroku_app":  ds.appOf(qc),
+			"worker_type": qc.WorkerType,
+		}).Warn("MsgWorkerRatios is empty, so the queue never results in any workers")
+	}
+
+	if ds.CrashGuard && ev.decision == ScaleUp {
+		if ds.crashing(ctx, sc, qc) {
+			ev.decision = Hold
+			ev.newQuantity = ev.oldQuantity
+		}
+	}
+
+	return ev, nil
+}
+
+// capped does the work of target, using the MinWorkers of the current
+// MinWorkersSchedule window and the backlog averaged over the
+// SmoothingWindow, but never goes beyond WorkerCeiling.
+func (ds *DynoScaler) capped(qc WorkerConfig, qInfo rabbithole.QueueInfo, current int, stale bool) evaluation {
+	qc.MinWorkers = qc.minWorkersAt(ds.now())
+	sample := backlog(qc, qInfo)
+	ev := target(qc, qInfo, ds.smoothed(qc, sample), current, stale)
+	ev.sample = sample
+
+	if ds.WorkerCeiling > 0 && ev.decision == ScaleUp && ev.newQuantity > ds.WorkerCeiling {
+		ds.log.WithFields(logrus.Fields{
+			"heroku_app":       ds.appOf(qc),
+			"worker_type":      qc.WorkerType,
+			"desired_quantity": ev.newQuantity,
+			"worker_ceiling":   ds.WorkerCeiling,
+		}).Warn("desired quantity exceeds WorkerCeiling, clamping it")
+
+		ev.newQuantity = ds.WorkerCeiling
+		if ev.newQuantity <= ev.oldQuantity {
+			ev.decision = Hold
+			ev.newQuantity = ev.oldQuantity
+		}
+	}
+
+	if ev.decision.scales() && withinDeadband(qc, ev) {
+		ds.log.WithFields(logrus.Fields{
+			"heroku_app":       ds.appOf(qc),
+			"worker_type":      qc.WorkerType,
+			"desired_quantity": ev.newQuantity,
+			"deadband":         qc.Deadband,
+		}).Debug("desired quantity within Deadband, not scaling dynos")
+
+		ev.decision = Hold
+		ev.newQuantity = ev.oldQuantity
+	}
+
+	return ev
+}
+
+// withinDeadband reports whether the new quantity of ev differs from
+// the old one by no more than the Deadband of qc. Scaling to or from
+// zero is never within it, and neither is settling the workers of an
+// empty queue at the MinWorkers of qc.
+func withinDeadband(qc WorkerConfig, ev evaluation) bool {
+	if qc.Deadband <= 0 || ev.newQuantity == 0 || ev.oldQuantity == 0 {
+		return false
+	}
+
+	if ev.totalMsgs == 0 {
+		down := ev.oldQuantity > qc.MinWorkers && ev.newQuantity < ev.oldQuantity
+		up := ev.oldQuantity < qc.MinWorkers && ev.newQuantity > ev.oldQuantity
+		if down || up {
+			return false
+		}
+	}
+
+	diff := ev.newQuantity - ev.oldQuantity
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return diff <= qc.Deadband
+}
+
+// target works out the quantity the worker should be scaled to for
+// the backlog total, regardless of the cooldowns. When stale, the
+// oldest message has exceeded the MaxMessageAge, and at least one more
+// worker is wanted.
+func target(qc WorkerConfig, qInfo rabbithole.QueueInfo, total, current int, stale bool) evaluation {
+	ev := evaluation{
+		queueName:   qInfo.Name,
+		totalMsgs:   total,
+		sample:      total,
+		oldQuantity: current,
+		newQuantity: current,
+	}
+
+	busy := ev.totalMsgs > 0
+	if qc.ThresholdPolicy != ThresholdNone {
+		busy = busy || qInfo.MessageStats.PublishDetails.Rate > 0
+	}
+
+	if busy {
+		desiredQuantity := desiredWorkerCount(qc, ev.totalMsgs)
+		below := ev.totalMsgs < qc.ScaleUpThreshold
+		if qc.ThresholdPolicy != ThresholdNone {
+			desiredQuantity, below = combinedWorkerCount(qc, qInfo)
+		}
+
+		if stale && desiredQuantity <= current {
+			desiredQuantity, below = current+1, false
+		}
+
+		if desiredQuantity < qc.MinWorkers {
+			desiredQuantity = qc.MinWorkers
+		}
+
+		if qc.MaxWorkers > 0 && desiredQuantity > qc.MaxWorkers {
+			desiredQuantity = qc.MaxWorkers
+		}
+
+		if qc.MaxScaleUpStep > 0 && desiredQuantity > current+qc.MaxScaleUpStep {
+			desiredQuantity = current + qc.MaxScaleUpStep
+		}
+
+		switch {
+		case current < desiredQuantity && qc.RequireActiveQueue && qInfo.Status == queueIdle:
+			ev.decision = Hold
+		case current < desiredQuantity && below:
+			// not worth booting a dyno for
+			ev.decision = Hold
+		case current < desiredQuantity:
+			ev.decision = ScaleUp
+			ev.newQuantity = desiredQuantity
+		case current > desiredQuantity:
+			// the workers are only scaled down once the queue is empty
+			ev.decision = Hold
+		}
+	} else {
+		ev = settle(qc, ev)
+	}
+
+	return ev
+}
+
+// settle scales the workers of ev towards the MinWorkers of qc, where
+// they settle while the queue is empty: down to it, gradually if qc
+// has GradualScaleDown, or up to it, by at most the MaxScaleUpStep of
+// qc. Nothing changes once they are running the MinWorkers.
+func settle(qc WorkerConfig, ev evaluation) evaluation {
+	current := ev.oldQuantity
+
+	switch {
+	case current > qc.MinWorkers:
+		ev.decision = ScaleDown
+		ev.newQuantity = qc.MinWorkers
+
+		if qc.GradualScaleDown {
+			step := qc.ScaleDownStep
+			if step <= 0 {
+				step = 1
+			}
+
+			if current-step > ev.newQuantity {
+				ev.newQuantity = current - step
+			}
+		}
+	case current < qc.MinWorkers:
+		ev.decision = ScaleUp
+		ev.newQuantity = qc.MinWorkers
+
+		if qc.MaxScaleUpStep > 0 && ev.newQuantity > current+qc.MaxScaleUpStep {
+			ev.newQuantity = current + qc.MaxScaleUpStep
+		}
+	}
+
+	return ev
+}
+
+// throttle suppresses the scaling of ev as cooldown does. It records
+// since when the queue has been empty, and the backlog for the
+// SmoothingWindow, but not the scaling itself, as it may still fail or
+// be held back. See recordScaling.
+func (ds *DynoScaler) throttle(qc WorkerConfig, ev evaluation) evaluation {
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	ws := ds.state.worker(ds.appOf(qc), qc.WorkerType)
+	if ev.totalMsgs > 0 {
+		ws.emptySince = time.Time{}
+	} else if ws.emptySince.IsZero() {
+		ws.emptySince = ds.now()
+	}
+
+	ws.addSample(ev.sample, qc.SmoothingWindow)
+
+	if ev.decision != ScaleDown {
+		ws.scaleDownSince = time.Time{}
+	} else if ws.scaleDownSince.IsZero() {
+		ws.scaleDownSince = ds.now()
+	}
+
+	return ds.cooldown(qc, ev)
+}
+
+// recordScaling records the time of the scaling of ev for the cooldowns
+// of qc, once the dynos have actually been scaled.
+func (ds *DynoScaler) recordScaling(qc WorkerConfig, ev evaluation) {
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	ws := ds.state.worker(ds.appOf(qc), qc.WorkerType)
+
+	switch ev.decision {
+	case ScaleUp:
+		ws.lastScaleUp = ds.now()
+	case ScaleDown:
+		ws.lastScaleDown = ds.now()
+	}
+}
+
+// cooldown suppresses the scaling of ev while the cooldowns of qc
+// haven't passed yet, holds off scaling down until the queue has
+// been empty for the ScaleToZeroDelay of qc, and keeps the
+// ScaleDownBuffer of qc during its TTL, without recording anything.
+// A scaling to the current quantity is turned into NoChange, so that
+// the formation is never updated for nothing. The caller must hold
+// ds.state.mu.
+func (ds *DynoScaler) cooldown(qc WorkerConfig, ev evaluation) evaluation {
+	app := ds.appOf(qc)
+	ws := ds.state.worker(app, qc.WorkerType)
+	now := ds.now()
+
+	if ev.decision.scales() && ev.newQuantity == ev.oldQuantity {
+		ds.log.WithFields(logrus.Fields{
+			"heroku_app":   app,
+			"worker_type":  qc.WorkerType,
+			"new_quantity": ev.newQuantity,
+		}).Debug("already running the new quantity, not scaling dynos")
+
+		ev.decision = NoChange
+		return ev
+	}
+
+	if ev.decision == ScaleDown && qc.ScaleToZeroDelay > 0 {
+		if ws.emptySince.IsZero() || now.Sub(ws.emptySince) < qc.ScaleToZeroDelay {
+			ds.log.WithFields(logrus.Fields{
+				"heroku_app":  app,
+				"worker_type": qc.WorkerType,
+			}).Debug("waiting for the queue to stay empty before scaling down")
+
+			ev.decision = Hold
+			ev.newQuantity = ev.oldQuantity
+			return ev
+		}
+	}
+
+	if ev.decision == ScaleDown && qc.ScaleDownBuffer > 0 {
+		// throttle hasn't recorded the start of the scale-down yet
+		// during Plan, which is as good as now
+		since := ws.scaleDownSince
+		if since.IsZero() {
+			since = now
+		}
+
+		if now.Sub(since) < qc.ScaleDownBufferTTL {
+			buffered := ev.newQuantity + qc.ScaleDownBuffer
+			if buffered >= ev.oldQuantity {
+				ds.log.WithFields(logrus.Fields{
+					"heroku_app":  app,
+					"worker_type": qc.WorkerType,
+				}).Debug("keeping the ScaleDownBuffer, not scaling down")
+
+				ev.decision = Hold
+				ev.newQuantity = ev.oldQuantity
+				return ev
+			}
+
+			ev.newQuantity = buffered
+		}
+	}
+
+	if ev.decision == ScaleUp && ds.ScaleUpCooldown > 0 && now.Sub(ws.lastScaleUp) < ds.ScaleUpCooldown {
+		ds.log.WithFields(logrus.Fields{
+			"heroku_app":  app,
+			"worker_type": qc.WorkerType,
+		}).Debug("scale-up suppressed by cooldown")
+
+		ev.decision = CooldownSuppressed
+		ev.newQuantity = ev.oldQuantity
+	}
+
+	if ev.decision == ScaleDown && ds.ScaleDownCooldown > 0 && now.Sub(ws.lastScaleDown) < ds.ScaleDownCooldown {
+		ds.log.WithFields(logrus.Fields{
+			"heroku_app":  app,
+			"worker_type": qc.WorkerType,
+		}).Debug("scale-down suppressed by cooldown")
+
+		ev.decision = CooldownSuppressed
+		ev.newQuantity = ev.oldQuantity
+	}
+
+	return ev
 }
@@ -1,16 +1,31 @@
 package dynoscaler
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	heroku "github.com/heroku/heroku-go/v3"
 	rabbithole "github.com/michaelklishin/rabbit-hole"
+	"github.com/sirupsen/logrus"
 )
 
 func TestCheckScalingDown(t *testing.T) {
 	ds := NewDynoScaler("", "", "", "", "")
 
-	newQuantity, scale, err := ds.checkScaling(
+	ev, err := checkOnce(&ds,
 		WorkerConfig{
 			MsgWorkerRatios: map[int]int{1: 1},
 			QueueName:       "foo",
@@ -34,11 +49,11 @@ func TestCheckScalingDown(t *testing.T) {
 		t.Fatalf("expected error to be nil, got %s", err.Error())
 	}
 
-	if newQuantity != 0 {
-		t.Errorf("expected newQuantity to be 0, got %d", newQuantity)
+	if ev.NewQuantity != 0 {
+		t.Errorf("expected newQuantity to be 0, got %d", ev.NewQuantity)
 	}
 
-	if !scale {
+	if !ev.Scaled {
 		t.Error("expected scale to be true")
 	}
 }
@@ -46,7 +61,7 @@ func TestCheckScalingDown(t *testing.T) {
 func TestCheckScalingUp(t *testing.T) {
 	ds := NewDynoScaler("", "", "", "", "")
 
-	newQuantity, scale, err := ds.checkScaling(
+	ev, err := checkOnce(&ds,
 		WorkerConfig{
 			MsgWorkerRatios: map[int]int{1: 1},
 			QueueName:       "foo",
@@ -70,11 +85,11 @@ func TestCheckScalingUp(t *testing.T) {
 		t.Fatalf("expected error to be nil, got %s", err.Error())
 	}
 
-	if newQuantity != 1 {
-		t.Errorf("expected newQuantity to be 1, got %d", newQuantity)
+	if ev.NewQuantity != 1 {
+		t.Errorf("expected newQuantity to be 1, got %d", ev.NewQuantity)
 	}
 
-	if !scale {
+	if !ev.Scaled {
 		t.Error("expected scale to be true")
 	}
 }
@@ -82,7 +97,7 @@ func TestCheckScalingUp(t *testing.T) {
 func TestCheckScalingUpMultiple(t *testing.T) {
 	ds := NewDynoScaler("", "", "", "", "")
 
-	newQuantity, scale, err := ds.checkScaling(
+	ev, err := checkOnce(&ds,
 		WorkerConfig{
 			MsgWorkerRatios: map[int]int{1: 1, 5: 2, 10: 4},
 			QueueName:       "foo",
@@ -106,21 +121,59 @@ func TestCheckScalingUpMultiple(t *testing.T) {
 		t.Fatalf("expected error to be nil, got %s", err.Error())
 	}
 
-	if newQuantity != 4 {
-		t.Errorf("expected newQuantity to be 4, got %d", newQuantity)
+	if ev.NewQuantity != 4 {
+		t.Errorf("expected newQuantity to be 4, got %d", ev.NewQuantity)
 	}
 
-	if !scale {
+	if !ev.Scaled {
 		t.Error("expected scale to be true")
 	}
 }
 
-func TestCheckScalingNone(t *testing.T) {
+func TestCheckScalingDownToMinWorkers(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 4},
+			MinWorkers:      2,
+			QueueName:       "foo",
+			WorkerType:      "bar",
+		},
+		[]rabbithole.QueueInfo{
+			{
+				Name:                   "foo",
+				MessagesUnacknowledged: 0,
+				Messages:               0,
+			},
+		}, []heroku.Formation{
+			{
+				Quantity: 4,
+				Type:     "bar",
+			},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 2 {
+		t.Errorf("expected newQuantity to be 2, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+}
+
+func TestCheckScalingAtMinWorkers(t *testing.T) {
 	ds := NewDynoScaler("", "", "", "", "")
 
-	_, scale, err := ds.checkScaling(
+	ev, err := checkOnce(&ds,
 		WorkerConfig{
 			MsgWorkerRatios: map[int]int{1: 1},
+			MinWorkers:      2,
 			QueueName:       "foo",
 			WorkerType:      "bar",
 		},
@@ -130,6 +183,39 @@ func TestCheckScalingNone(t *testing.T) {
 				MessagesUnacknowledged: 0,
 				Messages:               0,
 			},
+		}, []heroku.Formation{
+			{
+				Quantity: 2,
+				Type:     "bar",
+			},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.Scaled {
+		t.Error("expected scale to be false")
+	}
+}
+
+func TestCheckScalingUpToMinWorkers(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			MinWorkers:      2,
+			QueueName:       "foo",
+			WorkerType:      "bar",
+		},
+		[]rabbithole.QueueInfo{
+			{
+				Name:                   "foo",
+				MessagesUnacknowledged: 0,
+				Messages:               1,
+			},
 		}, []heroku.Formation{
 			{
 				Quantity: 0,
@@ -142,15 +228,177 @@ func TestCheckScalingNone(t *testing.T) {
 		t.Fatalf("expected error to be nil, got %s", err.Error())
 	}
 
-	if scale {
+	if ev.NewQuantity != 2 {
+		t.Errorf("expected newQuantity to be 2, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+}
+
+func TestCheckScalingEmptyQueueSettlesAtMinWorkers(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	cases := []struct {
+		current  int
+		expected int
+		scale    bool
+	}{
+		{current: 3, expected: 1, scale: true},
+		{current: 1, expected: 1, scale: false},
+		{current: 0, expected: 1, scale: true},
+	}
+
+	for _, c := range cases {
+		ev, err := checkOnce(&ds,
+			WorkerConfig{
+				MsgWorkerRatios: map[int]int{1: 1},
+				MinWorkers:      1,
+				QueueName:       "foo",
+				WorkerType:      "bar",
+			},
+			[]rabbithole.QueueInfo{{Name: "foo", Messages: 0}},
+			[]heroku.Formation{{Quantity: c.current, Type: "bar"}},
+		)
+
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if ev.Scaled != c.scale {
+			t.Errorf("expected scale from %d to be %t, got %t", c.current, c.scale, ev.Scaled)
+		}
+
+		if ev.Scaled && ev.NewQuantity != c.expected {
+			t.Errorf("expected newQuantity from %d to be %d, got %d", c.current, c.expected, ev.NewQuantity)
+		}
+	}
+}
+
+func TestCheckScalingDeadband(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	cases := []struct {
+		current  int
+		msgs     int
+		min      int
+		expected int
+		scale    bool
+	}{
+		// 4→5 is within the deadband
+		{current: 4, msgs: 10, expected: 4, scale: false},
+		{current: 4, msgs: 20, expected: 6, scale: true},
+		// scaling to or from zero ignores it
+		{current: 1, msgs: 0, expected: 0, scale: true},
+		{current: 0, msgs: 1, expected: 1, scale: true},
+		// and so does settling an empty queue at the MinWorkers
+		{current: 2, msgs: 0, min: 1, expected: 1, scale: true},
+		{current: 4, msgs: 0, min: 3, expected: 3, scale: true},
+		{current: 2, msgs: 0, min: 3, expected: 3, scale: true},
+	}
+
+	for _, c := range cases {
+		ev, err := checkOnce(&ds,
+			WorkerConfig{
+				MsgWorkerRatios: map[int]int{1: 1, 10: 5, 20: 6},
+				MinWorkers:      c.min,
+				Deadband:        1,
+				QueueName:       "foo",
+				WorkerType:      "bar",
+			},
+			[]rabbithole.QueueInfo{{Name: "foo", Messages: c.msgs}},
+			[]heroku.Formation{{Quantity: c.current, Type: "bar"}},
+		)
+
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if ev.Scaled != c.scale {
+			t.Errorf("expected scale from %d with %d msgs to be %t, got %t", c.current, c.msgs, c.scale, ev.Scaled)
+		}
+
+		if ev.NewQuantity != c.expected {
+			t.Errorf("expected newQuantity from %d with %d msgs to be %d, got %d", c.current, c.msgs, c.expected, ev.NewQuantity)
+		}
+	}
+}
+
+func TestCheckScalingUpToMaxWorkers(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 100: 10},
+			MaxWorkers:      4,
+			QueueName:       "foo",
+			WorkerType:      "bar",
+		},
+		[]rabbithole.QueueInfo{
+			{
+				Name:                   "foo",
+				MessagesUnacknowledged: 0,
+				Messages:               100,
+			},
+		}, []heroku.Formation{
+			{
+				Quantity: 1,
+				Type:     "bar",
+			},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 4 {
+		t.Errorf("expected newQuantity to be 4, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+}
+
+func TestCheckScalingAtMaxWorkers(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 100: 10},
+			MaxWorkers:      4,
+			QueueName:       "foo",
+			WorkerType:      "bar",
+		},
+		[]rabbithole.QueueInfo{
+			{
+				Name:                   "foo",
+				MessagesUnacknowledged: 0,
+				Messages:               100,
+			},
+		}, []heroku.Formation{
+			{
+				Quantity: 4,
+				Type:     "bar",
+			},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.Scaled {
 		t.Error("expected scale to be false")
 	}
 }
 
-func TestCheckScalingNoQueueInfo(t *testing.T) {
+func TestCheckScalingNone(t *testing.T) {
 	ds := NewDynoScaler("", "", "", "", "")
 
-	_, _, err := ds.checkScaling(
+	ev, err := checkOnce(&ds,
 		WorkerConfig{
 			MsgWorkerRatios: map[int]int{1: 1},
 			QueueName:       "foo",
@@ -158,7 +406,7 @@ func TestCheckScalingNoQueueInfo(t *testing.T) {
 		},
 		[]rabbithole.QueueInfo{
 			{
-				Name:                   "zoo",
+				Name:                   "foo",
 				MessagesUnacknowledged: 0,
 				Messages:               0,
 			},
@@ -170,19 +418,19 @@ func TestCheckScalingNoQueueInfo(t *testing.T) {
 		},
 	)
 
-	if err == nil {
-		t.Fatal("expected error to not be nil")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
 	}
 
-	if err.Error() != "unable to find queue info from RabbitMQ data" {
-		t.Error("expected error about lack of RabbitMQ data")
+	if ev.Scaled {
+		t.Error("expected scale to be false")
 	}
 }
 
-func TestCheckScalingNoFormationInfo(t *testing.T) {
+func TestCheckScalingNoQueueInfo(t *testing.T) {
 	ds := NewDynoScaler("", "", "", "", "")
 
-	_, _, err := ds.checkScaling(
+	_, err := checkOnce(&ds,
 		WorkerConfig{
 			MsgWorkerRatios: map[int]int{1: 1},
 			QueueName:       "foo",
@@ -190,14 +438,14 @@ func TestCheckScalingNoFormationInfo(t *testing.T) {
 		},
 		[]rabbithole.QueueInfo{
 			{
-				Name:                   "foo",
+				Name:                   "zoo",
 				MessagesUnacknowledged: 0,
 				Messages:               0,
 			},
 		}, []heroku.Formation{
 			{
 				Quantity: 0,
-				Type:     "zoo",
+				Type:     "bar",
 			},
 		},
 	)
@@ -206,7 +454,3061 @@ func TestCheckScalingNoFormationInfo(t *testing.T) {
 		t.Fatal("expected error to not be nil")
 	}
 
-	if err.Error() != "unable to find formation info from Heroku data" {
-		t.Error("expected error about lack of formation data")
+	if !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected error about lack of RabbitMQ data, got %s", err.Error())
+	}
+
+	var missing *QueueNotFoundError
+	if !errors.As(err, &missing) || missing.Queue != "foo" {
+		t.Errorf("expected a QueueNotFoundError of foo, got %#v", err)
+	}
+}
+
+func TestCheckScalingMissingQueueAsEmpty(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	qc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		MinWorkers:      1,
+		QueueName:       "foo",
+		QueueNames:      []string{"baz"},
+		WorkerType:      "bar",
+	}
+	queues := []rabbithole.QueueInfo{{Name: "baz", Messages: 0}}
+	formations := []heroku.Formation{{Quantity: 3, Type: "bar"}}
+
+	if _, err := checkOnce(&ds, qc, queues, formations); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	qc.TreatMissingQueueAsEmpty = true
+
+	ev, err := checkOnce(&ds, qc, queues, formations)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+
+	if ev.NewQuantity != 1 {
+		t.Errorf("expected newQuantity to be 1, got %d", ev.NewQuantity)
+	}
+}
+
+func TestCurrentQuantityNoFormationInfo(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Quantity: 0, Type: "zoo"}}}
+	ds := newTestDynoScaler(hs, &fakeRabbit{})
+
+	// the checks skip the worker config, see TestCheckOnceAssumeZeroWhenFormationMissing
+	_, err := ds.newScaler("app").CurrentQuantity(context.Background(), "bar")
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if !errors.Is(err, ErrFormationNotFound) {
+		t.Errorf("expected error about lack of formation data, got %s", err.Error())
+	}
+
+	var missing *FormationNotFoundError
+	if !errors.As(err, &missing) || missing.WorkerType != "bar" {
+		t.Errorf("expected a FormationNotFoundError of bar, got %#v", err)
+	}
+}
+
+func TestSleepCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	err := sleep(ctx, time.Minute)
+
+	if err != context.Canceled {
+		t.Fatalf("expected error to be context.Canceled, got %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Error("expected sleep to return immediately after cancellation")
+	}
+}
+
+func TestScaleDynosCancelledContext(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+
+	hs := heroku.NewService(srv.Client())
+	hs.URL = srv.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	err := scaleDynos(ctx, hs, "app", "bar", 1)
+
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if uerr, ok := err.(*url.Error); !ok || uerr.Err != context.Canceled {
+		t.Errorf("expected a context cancellation error, got %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Error("expected scaleDynos to return immediately after cancellation")
+	}
+}
+
+func TestCheckScalingDownCooldown(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+	ds.ScaleDownCooldown = time.Minute
+
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	ds.now = func() time.Time { return now }
+
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+	queues := []rabbithole.QueueInfo{
+		{
+			Name:                   "foo",
+			MessagesUnacknowledged: 0,
+			Messages:               0,
+		},
+	}
+	formations := []heroku.Formation{
+		{
+			Quantity: 1,
+			Type:     "bar",
+		},
+	}
+
+	ev, err := checkOnce(&ds, wc, queues, formations)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if !ev.Scaled {
+		t.Error("expected first scale to be true")
+	}
+
+	now = now.Add(30 * time.Second)
+
+	ev, err = checkOnce(&ds, wc, queues, formations)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.Scaled {
+		t.Error("expected scale within the cooldown to be false")
+	}
+
+	now = now.Add(time.Minute)
+
+	ev, err = checkOnce(&ds, wc, queues, formations)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale after the cooldown to be true")
+	}
+}
+
+func TestCheckScalingDownCooldownAllowsScaleUp(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+	ds.ScaleDownCooldown = time.Minute
+
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+
+	ev, err := checkOnce(&ds, wc,
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 0}},
+		[]heroku.Formation{{Quantity: 1, Type: "bar"}},
+	)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale down to be true")
+	}
+
+	ev, err = checkOnce(&ds, wc,
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 1}},
+		[]heroku.Formation{{Quantity: 0, Type: "bar"}},
+	)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 1 {
+		t.Errorf("expected newQuantity to be 1, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale up to be true")
+	}
+}
+
+func TestCheckScalingUpCooldown(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+	ds.ScaleUpCooldown = time.Minute
+
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	ds.now = func() time.Time { return now }
+
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2, 30: 5},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+
+	ev, err := checkOnce(&ds, wc,
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 10}},
+		[]heroku.Formation{{Quantity: 0, Type: "bar"}},
+	)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 2 {
+		t.Errorf("expected newQuantity to be 2, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected first scale to be true")
+	}
+
+	now = now.Add(30 * time.Second)
+
+	ev, err = checkOnce(&ds, wc,
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 30}},
+		[]heroku.Formation{{Quantity: 2, Type: "bar"}},
+	)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.Scaled {
+		t.Error("expected scale within the cooldown to be false")
+	}
+
+	now = now.Add(time.Minute)
+
+	ev, err = checkOnce(&ds, wc,
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 30}},
+		[]heroku.Formation{{Quantity: 2, Type: "bar"}},
+	)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 5 {
+		t.Errorf("expected newQuantity to be 5, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale after the cooldown to be true")
+	}
+}
+
+func TestCheckScalingUpCooldownAllowsScaleDown(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+	ds.ScaleUpCooldown = time.Minute
+
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+
+	ev, err := checkOnce(&ds, wc,
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 1}},
+		[]heroku.Formation{{Quantity: 0, Type: "bar"}},
+	)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale up to be true")
+	}
+
+	ev, err = checkOnce(&ds, wc,
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 0}},
+		[]heroku.Formation{{Quantity: 1, Type: "bar"}},
+	)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 0 {
+		t.Errorf("expected newQuantity to be 0, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale down to be true")
+	}
+}
+
+func TestCheckOnceRetriesFailedScalingWithinCooldown(t *testing.T) {
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{{Type: "bar", Quantity: 0}},
+		updateErrs: []error{errors.New("unavailable")},
+	}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 5}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.ScaleUpCooldown = 5 * time.Minute
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ds.now = func() time.Time { return now }
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected the failed scaling to fail the check")
+	}
+
+	now = now.Add(10 * time.Second)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	calls := hs.updateCalls()
+	if len(calls) != 2 || calls[1].quantity != 1 {
+		t.Fatalf("expected the failed scaling to be retried by the next check, got %v", calls)
+	}
+
+	// the successful one starts the cooldown
+	now = now.Add(10 * time.Second)
+	hs.formations[0].Quantity = 0
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if n := len(hs.updateCalls()); n != 2 {
+		t.Errorf("expected the scaling to be suppressed by the cooldown, got %d updates", n)
+	}
+}
+
+func TestCheckOnce(t *testing.T) {
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{
+			{Type: "fooworker", Quantity: 0},
+			{Type: "barworker", Quantity: 3},
+		},
+	}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{
+			{Name: "foo", Messages: 10},
+			{Name: "bar", Messages: 0},
+		},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	// both worker types are scaled with a single batch update
+	batches := hs.batchCalls()
+	expected := []formationUpdate{
+		{app: "app", workerType: "fooworker", quantity: 2},
+		{app: "app", workerType: "barworker", quantity: 0},
+	}
+
+	if len(batches) != 1 {
+		t.Fatalf("expected 1 batch update, got %d", len(batches))
+	}
+
+	if len(batches[0]) != len(expected) {
+		t.Fatalf("expected %d updates, got %d", len(expected), len(batches[0]))
+	}
+
+	for i := range expected {
+		if batches[0][i] != expected[i] {
+			t.Errorf("expected update %d to be %+v, got %+v", i, expected[i], batches[0][i])
+		}
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 0 {
+		t.Errorf("expected no individual formation updates, got %+v", updates)
+	}
+}
+
+func TestCheckOnceListQueuesError(t *testing.T) {
+	hs := &fakeHeroku{}
+	rmqc := &fakeRabbit{err: errors.New("connection refused")}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if len(hs.updateCalls()) != 0 {
+		t.Error("expected no formation updates")
+	}
+}
+
+func TestCheckOnceContinuesAfterConfigError(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{
+		{Type: "fooworker", Quantity: 0},
+		{Type: "barworker", Quantity: 0},
+	}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "bar", Messages: 10}}}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "missing",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+
+	err := ds.CheckOnce(context.Background())
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if err.Error() != "failed to check scaling of fooworker: unable to find queue info of missing from RabbitMQ data" {
+		t.Errorf("expected error of the first config, got %s", err.Error())
+	}
+
+	if !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected the combined error to match ErrQueueNotFound, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "barworker", quantity: 2}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+}
+
+func TestCheckScalingMultipleFormations(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	formations := []heroku.Formation{
+		{Type: "fooworker", Quantity: 4},
+		{Type: "barworker", Quantity: 1},
+		{Type: "bazworker", Quantity: 7},
+	}
+	queues := []rabbithole.QueueInfo{
+		{Name: "foo", Messages: 0},
+		{Name: "bar", Messages: 10},
+		{Name: "baz", Messages: 30},
+	}
+
+	sc := &herokuScaler{hs: &fakeHeroku{formations: formations}, app: "app"}
+	ev, err := ds.assess(context.Background(), sc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2, 30: 5},
+		QueueName:       "bar",
+		WorkerType:      "barworker",
+	}, queues)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.oldQuantity != 1 {
+		t.Errorf("expected oldQuantity to be 1, got %d", ev.oldQuantity)
+	}
+
+	if ev.totalMsgs != 10 {
+		t.Errorf("expected totalMsgs to be 10, got %d", ev.totalMsgs)
+	}
+
+	if ev.newQuantity != 2 {
+		t.Errorf("expected newQuantity to be 2, got %d", ev.newQuantity)
+	}
+
+	if formations[1].Quantity != 1 || formations[2].Quantity != 7 {
+		t.Errorf("expected formations to be left untouched, got %+v", formations)
+	}
+}
+
+func TestCheckScalingByPublishRate(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 5: 2, 10: 4},
+			RatioMode:       RatioByPublishRate,
+			QueueName:       "foo",
+			WorkerType:      "bar",
+		},
+		[]rabbithole.QueueInfo{
+			{
+				Name:     "foo",
+				Messages: 1000,
+				MessageStats: rabbithole.MessageStats{
+					PublishDetails: rabbithole.RateDetails{Rate: 4.2},
+				},
+			},
+		}, []heroku.Formation{
+			{
+				Quantity: 0,
+				Type:     "bar",
+			},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	// 4.2 msg/s is rounded up to 5
+	if ev.NewQuantity != 2 {
+		t.Errorf("expected newQuantity to be 2, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+}
+
+func TestCheckScalingByPublishRateIdle(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			RatioMode:       RatioByPublishRate,
+			QueueName:       "foo",
+			WorkerType:      "bar",
+		},
+		[]rabbithole.QueueInfo{
+			{
+				Name:     "foo",
+				Messages: 1000,
+				MessageStats: rabbithole.MessageStats{
+					PublishDetails: rabbithole.RateDetails{Rate: 0},
+				},
+			},
+		}, []heroku.Formation{
+			{
+				Quantity: 2,
+				Type:     "bar",
+			},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 0 {
+		t.Errorf("expected newQuantity to be 0, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+}
+
+func TestCheckScalingConsumerAware(t *testing.T) {
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2, 100: 10},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+	queues := []rabbithole.QueueInfo{
+		{
+			Name:      "foo",
+			Messages:  100,
+			Consumers: 10,
+		},
+	}
+	formations := []heroku.Formation{
+		{
+			Quantity: 0,
+			Type:     "bar",
+		},
+	}
+
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds, wc, queues, formations)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 10 {
+		t.Errorf("expected newQuantity without ConsumerAware to be 10, got %d", ev.NewQuantity)
+	}
+
+	wc.ConsumerAware = true
+
+	ev, err = checkOnce(&ds, wc, queues, formations)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 2 {
+		t.Errorf("expected newQuantity with ConsumerAware to be 2, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+}
+
+func TestCheckScalingConsumerAwareNoConsumers(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			ConsumerAware:   true,
+			QueueName:       "foo",
+			WorkerType:      "bar",
+		},
+		[]rabbithole.QueueInfo{
+			{
+				Name:      "foo",
+				Messages:  10,
+				Consumers: 0,
+			},
+		}, []heroku.Formation{
+			{
+				Quantity: 0,
+				Type:     "bar",
+			},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 2 {
+		t.Errorf("expected newQuantity to be 2, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+}
+
+func TestCheckScalingBacklogFunc(t *testing.T) {
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2, 100: 10},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+	queues := []rabbithole.QueueInfo{
+		{
+			Name:                   "foo",
+			Messages:               5,
+			MessagesUnacknowledged: 95,
+		},
+	}
+	formations := []heroku.Formation{
+		{
+			Quantity: 0,
+			Type:     "bar",
+		},
+	}
+
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds, wc, queues, formations)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 10 {
+		t.Errorf("expected newQuantity counting the unacked messages to be 10, got %d", ev.NewQuantity)
+	}
+
+	wc.BacklogFunc = func(qInfo rabbithole.QueueInfo) int {
+		return qInfo.Messages
+	}
+
+	ev, err = checkOnce(&ds, wc, queues, formations)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 1 {
+		t.Errorf("expected newQuantity counting only the ready messages to be 1, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+}
+
+func TestCheckScalingRatioByUnacked(t *testing.T) {
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 50: 5, 100: 10},
+		RatioMode:       RatioByUnacked,
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+	formations := []heroku.Formation{{Type: "bar", Quantity: 1}}
+
+	ds := NewDynoScaler("", "", "", "", "")
+
+	cases := []struct {
+		name     string
+		qInfo    rabbithole.QueueInfo
+		expected int
+	}{
+		{"stuck consumers", rabbithole.QueueInfo{Name: "foo", Messages: 0, MessagesUnacknowledged: 50}, 5},
+		{"ready backlog", rabbithole.QueueInfo{Name: "foo", Messages: 100, MessagesUnacknowledged: 1}, 1},
+	}
+
+	for _, c := range cases {
+		ev, err := checkOnce(&ds, wc, []rabbithole.QueueInfo{c.qInfo}, formations)
+		if err != nil {
+			t.Fatalf("%s: expected error to be nil, got %s", c.name, err.Error())
+		}
+
+		if ev.NewQuantity != c.expected {
+			t.Errorf("%s: expected newQuantity to be %d, got %d", c.name, c.expected, ev.NewQuantity)
+		}
+	}
+}
+
+func TestCheckScalingMultipleQueues(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2, 20: 3},
+			QueueName:       "foo",
+			QueueNames:      []string{"zoo"},
+			WorkerType:      "bar",
+		},
+		[]rabbithole.QueueInfo{
+			{
+				Name:                   "foo",
+				MessagesUnacknowledged: 2,
+				Messages:               8,
+			},
+			{
+				Name:     "zoo",
+				Messages: 10,
+			},
+			{
+				Name:     "other",
+				Messages: 100,
+			},
+		}, []heroku.Formation{
+			{
+				Quantity: 1,
+				Type:     "bar",
+			},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 3 {
+		t.Errorf("expected newQuantity to be 3, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+}
+
+func TestCheckScalingMultipleQueuesMissing(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	_, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueNames:      []string{"foo", "zoo"},
+			WorkerType:      "bar",
+		},
+		[]rabbithole.QueueInfo{
+			{
+				Name:     "foo",
+				Messages: 1,
+			},
+		}, []heroku.Formation{
+			{
+				Quantity: 0,
+				Type:     "bar",
+			},
+		},
+	)
+
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	var missing *QueueNotFoundError
+	if !errors.As(err, &missing) || missing.Queue != "zoo" {
+		t.Errorf("expected a QueueNotFoundError of zoo, got %s", err.Error())
+	}
+}
+
+func TestCheckScalingQueueNamePattern(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios:  map[int]int{1: 1, 10: 2, 20: 3},
+			QueueNamePattern: `^orders\.tenant-\d+$`,
+			WorkerType:       "bar",
+		},
+		[]rabbithole.QueueInfo{
+			{
+				Name:     "orders.tenant-1234",
+				Messages: 5,
+			},
+			{
+				Name:     "orders.tenant-5678",
+				Messages: 5,
+			},
+			{
+				Name:     "invoices.tenant-1234",
+				Messages: 100,
+			},
+		}, []heroku.Formation{
+			{
+				Quantity: 1,
+				Type:     "bar",
+			},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 2 {
+		t.Errorf("expected newQuantity to be 2, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+}
+
+func TestCheckScalingQueueNamePatternCountsOnce(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios:  map[int]int{1: 1, 10: 2, 20: 3},
+			QueueName:        "orders.tenant-1",
+			QueueNamePattern: `^orders\.`,
+			WorkerType:       "bar",
+		},
+		[]rabbithole.QueueInfo{
+			{
+				Name:     "orders.tenant-1",
+				Messages: 15,
+			},
+		}, []heroku.Formation{
+			{
+				Quantity: 0,
+				Type:     "bar",
+			},
+		},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 2 {
+		t.Errorf("expected newQuantity to be 2, got %d", ev.NewQuantity)
+	}
+}
+
+func TestCheckScalingInvalidQueueNamePattern(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	_, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios:  map[int]int{1: 1},
+			QueueNamePattern: `orders.(`,
+			WorkerType:       "bar",
+		},
+		[]rabbithole.QueueInfo{
+			{
+				Name:     "orders.tenant-1",
+				Messages: 1,
+			},
+		}, []heroku.Formation{
+			{
+				Quantity: 0,
+				Type:     "bar",
+			},
+		},
+	)
+
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+}
+
+func TestScaleRetries(t *testing.T) {
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{{Type: "bar", Quantity: 0}},
+		updateErrs: []error{errors.New("first"), errors.New("second")},
+	}
+
+	ds := newTestDynoScaler(hs, &fakeRabbit{})
+	ds.ScaleRetries = 2
+	ds.retryDelay = time.Millisecond
+
+	if err := ds.scale(context.Background(), ds.newScaler("app"), "app", "bar", 3); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if n := len(hs.updateCalls()); n != 3 {
+		t.Errorf("expected 3 formation updates, got %d", n)
+	}
+
+	if hs.formations[0].Quantity != 3 {
+		t.Errorf("expected quantity to be 3, got %d", hs.formations[0].Quantity)
+	}
+}
+
+func TestScaleRetriesExhausted(t *testing.T) {
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{{Type: "bar", Quantity: 0}},
+		updateErrs: []error{errors.New("first"), errors.New("second"), errors.New("third")},
+	}
+
+	ds := newTestDynoScaler(hs, &fakeRabbit{})
+	ds.ScaleRetries = 2
+	ds.retryDelay = time.Millisecond
+
+	err := ds.scale(context.Background(), ds.newScaler("app"), "app", "bar", 3)
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if err.Error() != "third" {
+		t.Errorf("expected the last error to be returned, got %s", err.Error())
+	}
+
+	if n := len(hs.updateCalls()); n != 3 {
+		t.Errorf("expected 3 formation updates, got %d", n)
+	}
+}
+
+// noUpdateHeroku is a fakeHeroku which fails the test
+// whenever the formation is updated.
+type noUpdateHeroku struct {
+	*fakeHeroku
+	t *testing.T
+}
+
+func (nh noUpdateHeroku) FormationUpdate(ctx context.Context, appIdentity string, formationIdentity string, o heroku.FormationUpdateOpts) (*heroku.Formation, error) {
+	nh.t.Fatalf("expected FormationUpdate to not be called, got %s=%d", formationIdentity, *o.Quantity)
+	return nil, nil
+}
+
+func TestCheckOnceDryRun(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "app", WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.DryRun = true
+	ds.hs = noUpdateHeroku{
+		fakeHeroku: &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}},
+		t:          t,
+	}
+	ds.rmqc = &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 5}}}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+}
+
+func TestCheckOnceScaleCallbacks(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 1}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	var calls []string
+	ds.BeforeScale = func(wc WorkerConfig, from, to int) error {
+		calls = append(calls, fmt.Sprintf("before %s %d->%d", wc.WorkerType, from, to))
+		return nil
+	}
+	ds.AfterScale = func(wc WorkerConfig, from, to int, err error) {
+		calls = append(calls, fmt.Sprintf("after %s %d->%d %v", wc.WorkerType, from, to, err))
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []string{"before bar 1->3", "after bar 1->3 <nil>"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected callbacks %v, got %v", expected, calls)
+	}
+
+	if n := len(hs.updateCalls()); n != 1 {
+		t.Errorf("expected 1 formation update, got %d", n)
+	}
+}
+
+func TestCheckOnceBeforeScaleAborts(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 1}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	afterCalled := false
+	ds.BeforeScale = func(wc WorkerConfig, from, to int) error {
+		return errors.New("not now")
+	}
+	ds.AfterScale = func(wc WorkerConfig, from, to int, err error) {
+		afterCalled = true
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if n := len(hs.updateCalls()); n != 0 {
+		t.Errorf("expected no formation updates, got %d", n)
+	}
+
+	if afterCalled {
+		t.Error("expected AfterScale to not be called")
+	}
+}
+
+func TestCheckOnceAllowScaleDown(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{
+		{Type: "bar", Quantity: 3},
+		{Type: "baz", Quantity: 1},
+	}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{
+		{Name: "foo", Messages: 0},
+		{Name: "qux", Messages: 10},
+	}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+		QueueName:       "qux",
+		WorkerType:      "baz",
+	})
+
+	var asked []string
+	ds.AllowScaleDown = func(wc WorkerConfig) bool {
+		asked = append(asked, wc.WorkerType)
+		return false
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if expected := []string{"bar"}; !reflect.DeepEqual(asked, expected) {
+		t.Errorf("expected AllowScaleDown to be called for %v, got %v", expected, asked)
+	}
+
+	calls := hs.updateCalls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 formation update, got %d", len(calls))
+	}
+
+	if calls[0].workerType != "baz" || calls[0].quantity != 3 {
+		t.Errorf("expected baz to be scaled up to 3, got %s to %d", calls[0].workerType, calls[0].quantity)
+	}
+
+	for _, status := range ds.Snapshot() {
+		if status.WorkerType == "bar" && status.DesiredQuantity != 3 {
+			t.Errorf("expected bar to be held at 3 workers, got %d", status.DesiredQuantity)
+		}
+	}
+
+	ds.AllowScaleDown = func(wc WorkerConfig) bool { return true }
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	calls = hs.updateCalls()
+	if len(calls) != 2 || calls[1].workerType != "bar" || calls[1].quantity != 0 {
+		t.Errorf("expected bar to be scaled down to 0 once allowed, got %v", calls)
+	}
+}
+
+func TestCheckOncePaused(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 1}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	ds.ScaleUpCooldown = 5 * time.Minute
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ds.now = func() time.Time { return now }
+
+	afterCalled := false
+	ds.AfterScale = func(wc WorkerConfig, from, to int, err error) {
+		afterCalled = true
+	}
+
+	var buf bytes.Buffer
+	ds.Logger.SetOutput(&buf)
+
+	ds.Pause()
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if n := len(hs.updateCalls()); n != 0 {
+		t.Errorf("expected no formation updates while paused, got %d", n)
+	}
+
+	if afterCalled {
+		t.Error("expected AfterScale to not be called while paused")
+	}
+
+	if !strings.Contains(buf.String(), "scaling is paused, not scaling dynos") {
+		t.Errorf("expected the paused scaling to be logged, got %s", buf.String())
+	}
+
+	// the scaling held back while paused doesn't start the cooldown
+	ds.Resume()
+	now = now.Add(10 * time.Second)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	calls := hs.updateCalls()
+	if len(calls) != 1 || calls[0].quantity != 3 {
+		t.Errorf("expected bar to be scaled to 3 once resumed, got %v", calls)
+	}
+}
+
+func TestPauseConcurrently(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 1}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.Logger.SetOutput(&syncBuffer{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+			ds.Pause()
+			ds.Resume()
+		}()
+
+		go func() {
+			defer wg.Done()
+			_ = ds.CheckOnce(context.Background())
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestRabbitMQURL(t *testing.T) {
+	cases := map[string]string{
+		"baboon.rmq.cloudamqp.com": "https://baboon.rmq.cloudamqp.com",
+		"http://localhost:15672":   "http://localhost:15672",
+		"https://localhost:15671":  "https://localhost:15671",
+	}
+
+	for host, expected := range cases {
+		ds := NewDynoScaler(host, "username", "password", "apikey", "app")
+		ds.hs = &fakeHeroku{}
+
+		if err := ds.initClients(); err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		rmqc, ok := ds.rmqc.(*rabbithole.Client)
+		if !ok {
+			t.Fatalf("expected RabbitMQ client to be a *rabbithole.Client, got %T", ds.rmqc)
+		}
+
+		if rmqc.Endpoint != expected {
+			t.Errorf("expected endpoint of %s to be %s, got %s", host, expected, rmqc.Endpoint)
+		}
+	}
+}
+
+func TestRabbitMQURLPort(t *testing.T) {
+	ds := NewDynoScaler("baboon.rmq.cloudamqp.com", "username", "password", "apikey", "app")
+	ds.RabbitMQPort = 8443
+
+	if u := ds.rabbitMQURL(); u != "https://baboon.rmq.cloudamqp.com:8443" {
+		t.Errorf("expected URL to be https://baboon.rmq.cloudamqp.com:8443, got %s", u)
+	}
+
+	ds = NewDynoScaler("http://localhost", "username", "password", "apikey", "app")
+	ds.RabbitMQPort = 15672
+
+	if u := ds.rabbitMQURL(); u != "http://localhost:15672" {
+		t.Errorf("expected URL to be http://localhost:15672, got %s", u)
+	}
+}
+
+func TestCheckOnceVhost(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{
+		{Name: "foo", Vhost: "/", Messages: 30},
+		{Name: "foo", Vhost: "orders", Messages: 10},
+	}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2, 30: 5},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.Vhost = "orders"
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if !reflect.DeepEqual(rmqc.vhosts, []string{"orders"}) {
+		t.Errorf("expected queues to be listed in vhost orders, got %v", rmqc.vhosts)
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "bar", quantity: 2}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+}
+
+func TestCheckOnceRabbitMQTransport(t *testing.T) {
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"name": "foo", "vhost": "/", "messages": 0}]`)
+	}))
+	defer server.Close()
+
+	ds := NewDynoScaler(server.URL, "username", "password", "apikey", "app")
+	ds.hs = &fakeHeroku{}
+
+	// the certificate of the test server is only trusted by its own transport
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil without the transport")
+	}
+
+	ds.rmqc = nil
+	ds.RabbitMQTransport = server.Client().Transport.(*http.Transport)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if requests != 1 {
+		t.Errorf("expected 1 request to reach the server, got %d", requests)
+	}
+}
+
+func TestCheckOnceHerokuURL(t *testing.T) {
+	var mu sync.Mutex
+	var updates []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer apikey" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/apps/app/formation":
+			fmt.Fprint(w, `[{"type": "bar", "quantity": 1}]`)
+		case r.Method == "PATCH" && r.URL.Path == "/apps/app/formation/bar":
+			var opts heroku.FormationUpdateOpts
+			if err := json.NewDecoder(r.Body).Decode(&opts); err != nil || opts.Quantity == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			mu.Lock()
+			updates = append(updates, fmt.Sprintf("bar=%d", *opts.Quantity))
+			mu.Unlock()
+
+			fmt.Fprintf(w, `{"type": "bar", "quantity": %d}`, *opts.Quantity)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ds := NewDynoScaler("", "", "", "apikey", "app", WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.HerokuURL = server.URL
+	ds.rmqc = &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !reflect.DeepEqual(updates, []string{"bar=3"}) {
+		t.Errorf("expected formation updates to be [bar=3], got %v", updates)
+	}
+
+	if heroku.DefaultTransport.BearerToken != "" {
+		t.Error("expected heroku.DefaultTransport to be left untouched")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	hs := &fakeHeroku{}
+	rmqc := &fakeRabbit{}
+	ds := newTestDynoScaler(hs, rmqc)
+
+	if err := ds.Verify(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if rmqc.calls != 1 {
+		t.Errorf("expected queues to be listed once, got %d", rmqc.calls)
+	}
+
+	if n := len(hs.updateCalls()); n != 0 {
+		t.Errorf("expected no formation updates, got %d", n)
+	}
+}
+
+func TestVerifyHerokuFails(t *testing.T) {
+	rmqc := &fakeRabbit{}
+	ds := newTestDynoScaler(&fakeHeroku{dynoListErr: errors.New("unauthorized")}, rmqc)
+
+	err := ds.Verify(context.Background())
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if err.Error() != "failed to verify Heroku app exists: unauthorized" {
+		t.Errorf("expected Heroku error, got %s", err.Error())
+	}
+
+	if rmqc.calls != 0 {
+		t.Errorf("expected queues to not be listed, got %d calls", rmqc.calls)
+	}
+}
+
+func TestVerifyRabbitMQFails(t *testing.T) {
+	ds := newTestDynoScaler(&fakeHeroku{}, &fakeRabbit{err: errors.New("connection refused")})
+
+	err := ds.Verify(context.Background())
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if err.Error() != "failed to verify RabbitMQ is reachable: connection refused" {
+		t.Errorf("expected RabbitMQ error, got %s", err.Error())
+	}
+}
+
+func TestCheckOnceMissingFormation(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "barworker", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{
+		{Name: "foo", Messages: 10},
+		{Name: "bar", Messages: 10},
+	}}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "foo",
+			WorkerType:      "notdeployed",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "barworker", quantity: 2}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+}
+
+func TestCheckOnceMultipleApps(t *testing.T) {
+	// the fake serves the same formations for every app
+	hs := &fakeHeroku{formations: []heroku.Formation{
+		{Type: "worker", Quantity: 0},
+		{Type: "mailer", Quantity: 0},
+	}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{
+		{Name: "jobs", Messages: 10},
+		{Name: "mails", Messages: 1},
+	}}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			QueueName:       "jobs",
+			WorkerType:      "worker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+			QueueName:       "jobs",
+			WorkerType:      "worker",
+			HerokuAppID:     "staging",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "mails",
+			WorkerType:      "mailer",
+			HerokuAppID:     "staging",
+		},
+	)
+	ds.ScaleUpCooldown = time.Hour
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "worker", quantity: 2}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+
+	// the worker types of the same app are scaled together
+	expectedBatches := [][]formationUpdate{{
+		{app: "staging", workerType: "worker", quantity: 3},
+		{app: "staging", workerType: "mailer", quantity: 1},
+	}}
+	if batches := hs.batchCalls(); !reflect.DeepEqual(batches, expectedBatches) {
+		t.Errorf("expected formation batch updates to be %+v, got %+v", expectedBatches, batches)
+	}
+
+	if !reflect.DeepEqual(hs.formationLists, []string{"app", "staging"}) {
+		t.Errorf("expected formations to be listed once per app, got %v", hs.formationLists)
+	}
+}
+
+func TestVerifyMultipleApps(t *testing.T) {
+	hs := &fakeHeroku{}
+	ds := newTestDynoScaler(hs, &fakeRabbit{}, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "jobs",
+		WorkerType:      "worker",
+		HerokuAppID:     "staging",
+	})
+
+	if err := ds.Verify(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if !reflect.DeepEqual(hs.dynoLists, []string{"app", "staging"}) {
+		t.Errorf("expected both apps to be verified, got %v", hs.dynoLists)
+	}
+}
+
+func TestCheckScalingLinear(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	stepped := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2, 30: 5},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+	linear := WorkerConfig{
+		RatioMode:         RatioLinear,
+		MessagesPerWorker: 10,
+		MaxWorkers:        8,
+		QueueName:         "foo",
+		WorkerType:        "bar",
+	}
+
+	cases := []struct {
+		msgs    int
+		stepped int
+		linear  int
+	}{
+		{1, 1, 1},
+		{10, 2, 1},
+		{11, 2, 2},
+		{29, 2, 3},
+		{30, 5, 3},
+		{45, 5, 5},
+		{1000, 5, 8},
+	}
+
+	for _, c := range cases {
+		queues := []rabbithole.QueueInfo{{Name: "foo", Messages: c.msgs}}
+		formations := []heroku.Formation{{Type: "bar", Quantity: 0}}
+
+		ev, err := checkOnce(&ds, stepped, queues, formations)
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if ev.NewQuantity != c.stepped {
+			t.Errorf("expected stepped newQuantity for %d messages to be %d, got %d", c.msgs, c.stepped, ev.NewQuantity)
+		}
+
+		ev, err = checkOnce(&ds, linear, queues, formations)
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if ev.NewQuantity != c.linear {
+			t.Errorf("expected linear newQuantity for %d messages to be %d, got %d", c.msgs, c.linear, ev.NewQuantity)
+		}
+	}
+}
+
+func TestCheckOnceGradualScaleDown(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 5}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 0}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios:  map[int]int{1: 1, 10: 5},
+		GradualScaleDown: true,
+		QueueName:        "foo",
+		WorkerType:       "bar",
+	})
+
+	for i := 0; i < 6; i++ {
+		if err := ds.CheckOnce(context.Background()); err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+	}
+
+	var quantities []int
+	for _, u := range hs.updateCalls() {
+		quantities = append(quantities, u.quantity)
+	}
+
+	if expected := []int{4, 3, 2, 1, 0}; !reflect.DeepEqual(quantities, expected) {
+		t.Errorf("expected formation updates to be %v, got %v", expected, quantities)
+	}
+}
+
+func TestCheckScalingGradualScaleDownStep(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	wc := WorkerConfig{
+		MsgWorkerRatios:  map[int]int{1: 1},
+		GradualScaleDown: true,
+		ScaleDownStep:    2,
+		MinWorkers:       1,
+		QueueName:        "foo",
+		WorkerType:       "bar",
+	}
+	queues := []rabbithole.QueueInfo{{Name: "foo", Messages: 0}}
+
+	for current, expected := range map[int]int{5: 3, 3: 1, 2: 1} {
+		ev, err := checkOnce(&ds, wc, queues, []heroku.Formation{{Type: "bar", Quantity: current}})
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if !ev.Scaled || ev.NewQuantity != expected {
+			t.Errorf("expected %d to scale down to %d, got %d (scale %t)", current, expected, ev.NewQuantity, ev.Scaled)
+		}
+	}
+}
+
+func TestCheckOnceMaxScaleUpStep(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 1}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 100}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 100: 10},
+		MaxScaleUpStep:  3,
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	for i := 0; i < 4; i++ {
+		if err := ds.CheckOnce(context.Background()); err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+	}
+
+	var quantities []int
+	for _, u := range hs.updateCalls() {
+		quantities = append(quantities, u.quantity)
+	}
+
+	if expected := []int{4, 7, 10}; !reflect.DeepEqual(quantities, expected) {
+		t.Errorf("expected formation updates to be %v, got %v", expected, quantities)
+	}
+}
+
+func TestMonitorContextCheckIntervals(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{
+		{Type: "fast", Quantity: 0},
+		{Type: "slow", Quantity: 0},
+	}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{
+		{Name: "foo", Messages: 0},
+		{Name: "bar", Messages: 0},
+	}}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			CheckInterval:   10 * time.Millisecond,
+			QueueName:       "foo",
+			WorkerType:      "fast",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "bar",
+			WorkerType:      "slow",
+		},
+	)
+	ds.CheckInterval = 100 * time.Millisecond
+	ds.minInterval = time.Millisecond
+	ds.Events = make(chan ScalingEvent, 1000)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	if err := ds.MonitorContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected error to be context.DeadlineExceeded, got %v", err)
+	}
+
+	checks := make(map[string]int)
+	for len(ds.Events) > 0 {
+		checks[(<-ds.Events).WorkerType]++
+	}
+
+	if checks["slow"] < 1 || checks["slow"] > 3 {
+		t.Errorf("expected the slow worker to be checked 1 to 3 times, got %d", checks["slow"])
+	}
+
+	if checks["fast"] < 3*checks["slow"] {
+		t.Errorf("expected the fast worker to be checked much more often than the slow one, got %d and %d", checks["fast"], checks["slow"])
+	}
+}
+
+func TestMonitorContextMinCheckInterval(t *testing.T) {
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{
+		{Name: "foo", Messages: 0},
+	}}
+
+	ds := newTestDynoScaler(&fakeHeroku{}, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		CheckInterval:   2 * time.Millisecond,
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	// also set after NewDynoScaler, which raised the default one
+	ds.CheckInterval = 0
+
+	intervals := ds.intervals()
+	if len(intervals) != 1 || intervals[0] != MinCheckInterval {
+		t.Errorf("expected the intervals to be raised to %s, got %v", MinCheckInterval, intervals)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := ds.MonitorContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected error to be context.DeadlineExceeded, got %v", err)
+	}
+
+	if rmqc.calls != 1 {
+		t.Errorf("expected 1 check within MinCheckInterval, got %d", rmqc.calls)
+	}
+}
+
+func TestCheckOnceReusesClients(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	ds := NewDynoScaler(server.URL, "username", "password", "apikey", "app")
+	ds.HerokuURL = server.URL
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	hs, rmqc := ds.hs, ds.rmqc
+
+	for i := 0; i < 2; i++ {
+		if err := ds.CheckOnce(context.Background()); err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+	}
+
+	if ds.hs != hs {
+		t.Error("expected the Heroku client to be reused")
+	}
+
+	if ds.rmqc != rmqc {
+		t.Error("expected the RabbitMQ client to be reused")
+	}
+}
+
+func TestMonitorContextMaxConsecutiveFailures(t *testing.T) {
+	rmqc := &fakeRabbit{err: errors.New("connection refused")}
+	ds := newTestDynoScaler(&fakeHeroku{}, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.CheckInterval = time.Millisecond
+	ds.minInterval = time.Millisecond
+	ds.MaxBackoff = 5 * time.Millisecond
+	ds.MaxConsecutiveFailures = 3
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := ds.MonitorContext(ctx)
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if err.Error() != "giving up after 3 consecutive failed checks: failed to list queues: connection refused" {
+		t.Errorf("expected error to be about giving up, got %s", err.Error())
+	}
+
+	if rmqc.calls != 3 {
+		t.Errorf("expected 3 checks, got %d", rmqc.calls)
+	}
+}
+
+func TestMonitorContextFailuresReset(t *testing.T) {
+	fail := errors.New("connection refused")
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{{Name: "foo"}},
+		errs:   []error{fail, nil, fail, nil, fail},
+		err:    fail,
+	}
+	ds := newTestDynoScaler(&fakeHeroku{formations: []heroku.Formation{{Type: "bar"}}}, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.CheckInterval = time.Millisecond
+	ds.minInterval = time.Millisecond
+	ds.MaxBackoff = 5 * time.Millisecond
+	ds.MaxConsecutiveFailures = 2
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := ds.MonitorContext(ctx); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	// the successful checks reset the count, so only the 5th and 6th fail in a row
+	if rmqc.calls != 6 {
+		t.Errorf("expected 6 checks, got %d", rmqc.calls)
+	}
+}
+
+// newSlowServer returns a server which only responds after 200ms,
+// unless the request is cancelled.
+func newSlowServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[]`)
+	}))
+}
+
+func TestVerifyHerokuTimeout(t *testing.T) {
+	server := newSlowServer()
+	defer server.Close()
+
+	ds := NewDynoScaler("", "", "", "apikey", "app")
+	ds.HerokuURL = server.URL
+	ds.rmqc = &fakeRabbit{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	err := ds.Verify(ctx)
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if !strings.HasPrefix(err.Error(), "failed to verify Heroku app exists") || !strings.Contains(err.Error(), "context deadline exceeded") {
+		t.Errorf("expected Heroku timeout error, got %s", err.Error())
+	}
+}
+
+func TestVerifyRabbitMQTimeout(t *testing.T) {
+	server := newSlowServer()
+	defer server.Close()
+
+	ds := NewDynoScaler(server.URL, "username", "password", "apikey", "app")
+	ds.hs = &fakeHeroku{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	err := ds.Verify(ctx)
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if err.Error() != "failed to verify RabbitMQ is reachable: context deadline exceeded" {
+		t.Errorf("expected RabbitMQ timeout error, got %s", err.Error())
+	}
+
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("expected Verify to return at the deadline, took %s", elapsed)
+	}
+}
+
+func TestCheckScalingEmptyRatios(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	// without any ratios, even a large queue results in zero workers
+	ev, err := checkOnce(&ds,
+		WorkerConfig{QueueName: "foo", WorkerType: "bar"},
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 1000}},
+		[]heroku.Formation{{Type: "bar", Quantity: 0}},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 0 || ev.Scaled {
+		t.Errorf("expected no scaling, got %d (scale %t)", ev.NewQuantity, ev.Scaled)
+	}
+}
+
+func TestCheckOnceEmptyRatiosWarning(t *testing.T) {
+	var buf bytes.Buffer
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1000}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{QueueName: "foo", WorkerType: "bar"})
+	ds.Logger.SetOutput(&buf)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if !strings.Contains(buf.String(), "MsgWorkerRatios is empty") {
+		t.Errorf("expected a warning about the empty MsgWorkerRatios, got %q", buf.String())
+	}
+
+	if n := len(hs.updateCalls()); n != 0 {
+		t.Errorf("expected no formation updates, got %d", n)
+	}
+}
+
+func TestCheckScalingWorkersPerMessage(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	cases := []struct {
+		ratio    float64
+		msgs     int
+		expected int
+	}{
+		{0.01, 250, 3},
+		{0.01, 1000, 10},
+		{0.07, 100, 7},
+		{0.5, 1, 1},
+	}
+
+	for _, c := range cases {
+		ev, err := checkOnce(&ds,
+			WorkerConfig{WorkersPerMessage: c.ratio, QueueName: "foo", WorkerType: "bar"},
+			[]rabbithole.QueueInfo{{Name: "foo", Messages: c.msgs}},
+			[]heroku.Formation{{Type: "bar", Quantity: 0}},
+		)
+
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if !ev.Scaled || ev.NewQuantity != c.expected {
+			t.Errorf("expected %g workers per message over %d messages to be %d workers, got %d", c.ratio, c.msgs, c.expected, ev.NewQuantity)
+		}
+	}
+}
+
+// waitForGoroutines waits up to a second for the number of goroutines
+// to drop to at most n, and returns the number of goroutines.
+func waitForGoroutines(n int) int {
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		count := runtime.NumGoroutine()
+		if count <= n || time.Now().After(deadline) {
+			return count
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMonitorStopAndRestart(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{
+		{Type: "fast", Quantity: 0},
+		{Type: "slow", Quantity: 0},
+	}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{
+		{Name: "foo", Messages: 0},
+		{Name: "bar", Messages: 0},
+	}}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			CheckInterval:   time.Millisecond,
+			QueueName:       "foo",
+			WorkerType:      "fast",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "bar",
+			WorkerType:      "slow",
+		},
+	)
+	ds.CheckInterval = time.Hour
+	ds.minInterval = time.Millisecond
+
+	// stopping before monitoring does nothing
+	ds.Stop()
+
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 3; i++ {
+		done := make(chan error)
+		go func() {
+			done <- ds.Monitor()
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		ds.Stop()
+		ds.Stop()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("expected error to be nil, got %s", err.Error())
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected Monitor to return after Stop")
+		}
+
+		if count := waitForGoroutines(before); count > before {
+			t.Errorf("expected at most %d goroutines after stopping, got %d", before, count)
+		}
+	}
+
+	rmqc.mu.Lock()
+	calls := rmqc.calls
+	rmqc.mu.Unlock()
+
+	if calls < 6 {
+		t.Errorf("expected the queues to be listed on each run, got %d calls", calls)
+	}
+}
+
+func TestCheckScalingRequireActiveQueue(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	qc := WorkerConfig{
+		MsgWorkerRatios:    map[int]int{1: 1, 10: 2},
+		RequireActiveQueue: true,
+		MinWorkers:         1,
+		QueueName:          "foo",
+		WorkerType:         "bar",
+	}
+
+	cases := []struct {
+		status   string
+		msgs     int
+		current  int
+		scale    bool
+		quantity int
+	}{
+		{"idle", 10, 1, false, 1},
+		{"running", 10, 1, true, 2},
+		{"idle", 0, 3, true, 1},
+		{"running", 0, 3, true, 1},
+	}
+
+	for _, c := range cases {
+		ev, err := checkOnce(&ds, qc,
+			[]rabbithole.QueueInfo{{Name: "foo", Status: c.status, Messages: c.msgs}},
+			[]heroku.Formation{{Type: "bar", Quantity: c.current}},
+		)
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if ev.Scaled != c.scale {
+			t.Errorf("%s queue with %d messages: expected scale to be %t, got %t", c.status, c.msgs, c.scale, ev.Scaled)
+		}
+
+		if ev.NewQuantity != c.quantity {
+			t.Errorf("%s queue with %d messages: expected newQuantity to be %d, got %d", c.status, c.msgs, c.quantity, ev.NewQuantity)
+		}
+	}
+}
+
+func TestCombinedQueueInfoIdle(t *testing.T) {
+	qc := WorkerConfig{QueueName: "foo", QueueNames: []string{"bar"}}
+
+	qInfo, err := combinedQueueInfo(qc, []rabbithole.QueueInfo{
+		{Name: "foo", Status: "idle"},
+		{Name: "bar", Status: "running"},
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if qInfo.Status == "idle" {
+		t.Error("expected the queues to be active while one of them is running")
+	}
+
+	qInfo, err = combinedQueueInfo(qc, []rabbithole.QueueInfo{
+		{Name: "foo", Status: "idle"},
+		{Name: "bar", Status: "idle"},
+	})
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if qInfo.Status != "idle" {
+		t.Errorf("expected status to be idle, got %q", qInfo.Status)
+	}
+}
+
+func TestCheckScalingScaleUpThreshold(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	qc := WorkerConfig{
+		MsgWorkerRatios:  map[int]int{1: 1, 5: 2},
+		ScaleUpThreshold: 5,
+		QueueName:        "foo",
+		WorkerType:       "bar",
+	}
+	formations := []heroku.Formation{{Type: "bar", Quantity: 0}}
+
+	ev, err := checkOnce(&ds, qc, []rabbithole.QueueInfo{{Name: "foo", Messages: 2}}, formations)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.Scaled {
+		t.Error("expected scale to be false below the threshold")
+	}
+
+	ev, err = checkOnce(&ds, qc, []rabbithole.QueueInfo{{Name: "foo", Messages: 6}}, formations)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true above the threshold")
+	}
+
+	if ev.NewQuantity != 2 {
+		t.Errorf("expected newQuantity to be 2, got %d", ev.NewQuantity)
+	}
+}
+
+func TestCheckOnceScaleToZeroDelay(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 2}}}
+	rmqc := &fakeRabbit{}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios:  map[int]int{1: 2},
+		ScaleToZeroDelay: time.Minute,
+		QueueName:        "foo",
+		WorkerType:       "bar",
+	})
+	ds.now = func() time.Time { return now }
+
+	checks := []struct {
+		after time.Duration
+		msgs  int
+	}{
+		{0, 0},
+		{30 * time.Second, 0},
+		// the message resets the delay
+		{20 * time.Second, 1},
+		{20 * time.Second, 0},
+		{50 * time.Second, 0},
+	}
+
+	for i, c := range checks {
+		now = now.Add(c.after)
+		rmqc.setQueues(rabbithole.QueueInfo{Name: "foo", Messages: c.msgs})
+
+		if err := ds.CheckOnce(context.Background()); err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if updates := hs.updateCalls(); len(updates) != 0 {
+			t.Fatalf("expected check %d to not scale down, got %+v", i, updates)
+		}
+	}
+
+	now = now.Add(10 * time.Second)
+	rmqc.setQueues(rabbithole.QueueInfo{Name: "foo", Messages: 0})
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "bar", quantity: 0}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+}
+
+func TestCheckOnceScaleDownBuffer(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 4}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 0}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios:    map[int]int{1: 1, 10: 4},
+		ScaleDownBuffer:    1,
+		ScaleDownBufferTTL: 5 * time.Minute,
+		QueueName:          "foo",
+		WorkerType:         "bar",
+	})
+	ds.now = func() time.Time { return now }
+
+	checks := []struct {
+		after    time.Duration
+		expected []formationUpdate
+	}{
+		// the buffer dyno is kept
+		{0, []formationUpdate{{app: "app", workerType: "bar", quantity: 1}}},
+		{time.Minute, nil},
+		{3 * time.Minute, nil},
+		// and released once the TTL has passed
+		{time.Minute, []formationUpdate{{app: "app", workerType: "bar", quantity: 0}}},
+		{time.Minute, nil},
+	}
+
+	for i, c := range checks {
+		now = now.Add(c.after)
+		hs.updates = nil
+
+		if err := ds.CheckOnce(context.Background()); err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if updates := hs.updateCalls(); !reflect.DeepEqual(updates, c.expected) {
+			t.Errorf("expected check %d to update the formation with %+v, got %+v", i, c.expected, updates)
+		}
+	}
+}
+
+func TestCheckOnceScaleDownBufferStartsOver(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 2}}}
+	rmqc := &fakeRabbit{}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios:    map[int]int{1: 1, 10: 2},
+		ScaleDownBuffer:    1,
+		ScaleDownBufferTTL: 5 * time.Minute,
+		QueueName:          "foo",
+		WorkerType:         "bar",
+	})
+	ds.now = func() time.Time { return now }
+
+	for i, msgs := range []int{1, 10, 1} {
+		now = now.Add(3 * time.Minute)
+		rmqc.setQueues(rabbithole.QueueInfo{Name: "foo", Messages: msgs})
+
+		if err := ds.CheckOnce(context.Background()); err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		// the scale-down of the last check starts a new TTL
+		if updates := hs.updateCalls(); len(updates) != 0 {
+			t.Fatalf("expected check %d to keep the buffer dyno, got %+v", i, updates)
+		}
+	}
+}
+
+func TestCheckOnceLogsSummary(t *testing.T) {
+	var buf bytes.Buffer
+
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{
+			{Type: "fooworker", Quantity: 0},
+			{Type: "barworker", Quantity: 2},
+			{Type: "bazworker", Quantity: 1},
+		},
+	}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{
+			{Name: "foo", Messages: 10},
+			{Name: "bar", Messages: 0},
+			{Name: "baz", Messages: 3},
+		},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{MsgWorkerRatios: map[int]int{1: 1, 10: 2}, QueueName: "foo", WorkerType: "fooworker"},
+		WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "bar", WorkerType: "barworker"},
+		WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "baz", WorkerType: "bazworker"},
+		WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "missing", WorkerType: "quxworker"},
+	)
+	ds.Logger.SetOutput(&buf)
+	ds.Logger.SetFormatter(&logrus.JSONFormatter{})
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	var summaries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("expected log line to be valid JSON, got %q", line)
+		}
+
+		if entry["msg"] == "check completed" {
+			summaries = append(summaries, entry)
+		}
+	}
+
+	if len(summaries) != 1 {
+		t.Fatalf("expected a single summary, got %v", summaries)
+	}
+
+	summary := summaries[0]
+	if summary["level"] != "info" {
+		t.Errorf("expected the summary to be logged at info, got %v", summary["level"])
+	}
+
+	for field, expected := range map[string]float64{
+		"configs":        3,
+		"scaled_up":      1,
+		"scaled_down":    1,
+		"held":           1,
+		"failed":         1,
+		"total_messages": 13,
+	} {
+		if summary[field] != expected {
+			t.Errorf("expected %s of the summary to be %v, got %v", field, expected, summary[field])
+		}
+	}
+
+	if _, ok := summary["duration"]; !ok {
+		t.Errorf("expected the summary to include the duration, got %v", summary)
+	}
+}
+
+func TestCheckOnceWorkerCeiling(t *testing.T) {
+	var buf bytes.Buffer
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10000000}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		WorkersPerMessage: 1,
+		QueueName:         "foo",
+		WorkerType:        "bar",
+	})
+	ds.Logger.SetOutput(&buf)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "bar", quantity: 1000}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+
+	if !strings.Contains(buf.String(), "exceeds WorkerCeiling") {
+		t.Errorf("expected a warning about the WorkerCeiling, got %q", buf.String())
+	}
+}
+
+func TestDesiredWorkerCountOverflow(t *testing.T) {
+	n := desiredWorkerCount(WorkerConfig{WorkersPerMessage: 1e30}, 10000000)
+	if n != math.MaxInt32 {
+		t.Errorf("expected the worker count to be capped at %d, got %d", math.MaxInt32, n)
+	}
+}
+
+func TestCheckScalingThresholdPolicy(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	cases := []struct {
+		policy   ThresholdPolicy
+		msgs     int
+		rate     float32
+		scale    bool
+		quantity int
+	}{
+		{ThresholdAnd, 20, 8, true, 3},
+		{ThresholdAnd, 20, 2, false, 0},
+		{ThresholdAnd, 3, 8, false, 0},
+		{ThresholdAnd, 3, 2, false, 0},
+		{ThresholdOr, 20, 8, true, 3},
+		{ThresholdOr, 20, 2, true, 3},
+		{ThresholdOr, 3, 8, true, 1},
+		{ThresholdOr, 3, 2, false, 0},
+	}
+
+	for _, c := range cases {
+		qc := WorkerConfig{
+			MsgWorkerRatios:  map[int]int{1: 1, 20: 3},
+			ThresholdPolicy:  c.policy,
+			ScaleUpThreshold: 10,
+			RateThreshold:    5,
+			QueueName:        "foo",
+			WorkerType:       "bar",
+		}
+
+		qInfo := rabbithole.QueueInfo{Name: "foo", Messages: c.msgs}
+		qInfo.MessageStats.PublishDetails.Rate = c.rate
+
+		ev, err := checkOnce(&ds, qc, []rabbithole.QueueInfo{qInfo}, []heroku.Formation{{Type: "bar", Quantity: 0}})
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if ev.Scaled != c.scale {
+			t.Errorf("%s with %d messages at %g/s: expected scale to be %t, got %t", c.policy, c.msgs, c.rate, c.scale, ev.Scaled)
+		}
+
+		if ev.Scaled && ev.NewQuantity != c.quantity {
+			t.Errorf("%s with %d messages at %g/s: expected newQuantity to be %d, got %d", c.policy, c.msgs, c.rate, c.quantity, ev.NewQuantity)
+		}
+	}
+}
+
+func TestCheckScalingThresholdPolicyScaleDown(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	qc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		ThresholdPolicy: ThresholdOr,
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+
+	// messages are still being published, even though the queue is empty
+	qInfo := rabbithole.QueueInfo{Name: "foo"}
+	qInfo.MessageStats.PublishDetails.Rate = 3
+
+	ev, err := checkOnce(&ds, qc, []rabbithole.QueueInfo{qInfo}, []heroku.Formation{{Type: "bar", Quantity: 1}})
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.Scaled {
+		t.Error("expected the workers to not be scaled down while messages are published")
+	}
+
+	qInfo.MessageStats.PublishDetails.Rate = 0
+
+	ev, err = checkOnce(&ds, qc, []rabbithole.QueueInfo{qInfo}, []heroku.Formation{{Type: "bar", Quantity: 1}})
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if !ev.Scaled || ev.NewQuantity != 0 {
+		t.Errorf("expected the workers to be scaled down to 0, got %d (scale %t)", ev.NewQuantity, ev.Scaled)
+	}
+}
+
+func TestCheckOnceDisabled(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{
+		{Type: "fooworker", Quantity: 0},
+		{Type: "barworker", Quantity: 0},
+	}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			// would fail the check, as the queue doesn't exist
+			Disabled:        true,
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+			HerokuAppID:     "other",
+		},
+	)
+	ds.Events = make(chan ScalingEvent, 2)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "fooworker", quantity: 1}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+
+	if !reflect.DeepEqual(hs.formationLists, []string{"app"}) {
+		t.Errorf("expected the formation of the disabled app to not be listed, got %v", hs.formationLists)
+	}
+
+	if n := len(ds.Events); n != 1 {
+		t.Errorf("expected 1 event, got %d", n)
+	}
+}
+
+func TestCheckOnceAllDisabled(t *testing.T) {
+	hs := &fakeHeroku{}
+	rmqc := &fakeRabbit{}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		Disabled:        true,
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if len(hs.formationLists) != 0 || len(hs.updateCalls()) != 0 {
+		t.Errorf("expected no Heroku calls, got %v and %+v", hs.formationLists, hs.updateCalls())
+	}
+}
+
+func TestCheckOnceAssumeZeroWhenFormationMissing(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "web", Quantity: 1}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+
+	ds := newTestDynoScaler(hs, rmqc, wc)
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 0 {
+		t.Fatalf("expected the missing formation to be skipped, got %+v", updates)
+	}
+
+	wc.AssumeZeroWhenFormationMissing = true
+	ds = newTestDynoScaler(hs, rmqc, wc)
+	ds.Events = make(chan ScalingEvent, 1)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "bar", quantity: 2}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+
+	if ev := <-ds.Events; ev.OldQuantity != 0 || ev.Decision != ScaleUp {
+		t.Errorf("expected a scale-up from 0, got %+v", ev)
+	}
+}
+
+func TestDesiredWorkerCountRoundingMode(t *testing.T) {
+	cases := []struct {
+		mode     RoundingMode
+		backlog  int
+		expected int
+	}{
+		{RoundUp, 24, 3},
+		{RoundUp, 26, 3},
+		{RoundDown, 24, 2},
+		{RoundDown, 26, 2},
+		{RoundNearest, 24, 2},
+		{RoundNearest, 26, 3},
+		{RoundNearest, 25, 3},
+	}
+
+	for _, c := range cases {
+		linear := WorkerConfig{RatioMode: RatioLinear, MessagesPerWorker: 10, RoundingMode: c.mode}
+		if n := desiredWorkerCount(linear, c.backlog); n != c.expected {
+			t.Errorf("linear %s with %d messages: expected %d workers, got %d", c.mode, c.backlog, c.expected, n)
+		}
+
+		perMessage := WorkerConfig{WorkersPerMessage: 0.1, RoundingMode: c.mode}
+		if n := desiredWorkerCount(perMessage, c.backlog); n != c.expected {
+			t.Errorf("per message %s with %d messages: expected %d workers, got %d", c.mode, c.backlog, c.expected, n)
+		}
+	}
+}
+
+func TestUpdateConfigs(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{
+		{Type: "fooworker", Quantity: 0},
+		{Type: "barworker", Quantity: 0},
+	}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{
+		{Name: "foo", Messages: 1},
+		{Name: "bar", Messages: 1},
+	}}
+
+	foo := WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "foo", WorkerType: "fooworker"}
+	bar := WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "bar", WorkerType: "barworker"}
+
+	ds := newTestDynoScaler(hs, rmqc, foo)
+	ds.ScaleUpCooldown = time.Hour
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	ds.UpdateConfigs(bar, foo)
+
+	statuses := ds.Snapshot()
+	if !statuses[0].LastChecked.IsZero() || statuses[1].LastChecked.IsZero() {
+		t.Errorf("expected the status of fooworker to move along with it, got %+v", statuses)
+	}
+
+	ds.UpdateConfigs(bar)
+
+	if _, ok := ds.state.workers[workerKey{app: "app", workerType: "fooworker"}]; ok {
+		t.Error("expected the state of the removed worker config to be forgotten")
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{
+		{app: "app", workerType: "fooworker", quantity: 1},
+		{app: "app", workerType: "barworker", quantity: 1},
+	}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+
+	// foo starts over without the cooldown of its previous scale-up
+	hs.mu.Lock()
+	hs.formations[0].Quantity = 0
+	hs.mu.Unlock()
+
+	ds.UpdateConfigs(foo)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 3 {
+		t.Errorf("expected fooworker to be scaled up again, got %+v", updates)
+	}
+}
+
+func TestMonitorUpdateConfigs(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{
+		{Type: "fooworker", Quantity: 0},
+		{Type: "barworker", Quantity: 0},
+	}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{
+		{Name: "foo", Messages: 0},
+		{Name: "bar", Messages: 0},
+	}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "fooworker",
+	})
+	ds.CheckInterval = 5 * time.Millisecond
+	ds.minInterval = time.Millisecond
+	ds.Events = make(chan ScalingEvent, 1000)
+
+	done := make(chan error)
+	go func() {
+		done <- ds.Monitor()
+	}()
+
+	waitFor := func(workerType string) {
+		timeout := time.After(time.Second)
+
+		for {
+			select {
+			case ev := <-ds.Events:
+				if ev.WorkerType == workerType {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("expected %s to be checked", workerType)
+			}
+		}
+	}
+
+	waitFor("fooworker")
+
+	// a new interval needs a goroutine of its own
+	ds.UpdateConfigs(WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		CheckInterval:   10 * time.Millisecond,
+		QueueName:       "bar",
+		WorkerType:      "barworker",
+	})
+
+	waitFor("barworker")
+
+	for len(ds.Events) > 0 {
+		<-ds.Events
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	for len(ds.Events) > 0 {
+		if ev := <-ds.Events; ev.WorkerType != "barworker" {
+			t.Errorf("expected only barworker to be checked after the update, got %s", ev.WorkerType)
+		}
+	}
+
+	ds.Stop()
+
+	if err := <-done; err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+}
+
+// slowHeroku is a fakeHeroku whose formations take delay to list,
+// unless the context is done first.
+type slowHeroku struct {
+	*fakeHeroku
+	delay time.Duration
+}
+
+func (sh slowHeroku) FormationList(ctx context.Context, appIdentity string, lr *heroku.ListRange) (heroku.FormationListResult, error) {
+	select {
+	case <-time.After(sh.delay):
+		return sh.fakeHeroku.FormationList(ctx, appIdentity, lr)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// slowRabbit is a fakeRabbit whose queues take delay to list.
+type slowRabbit struct {
+	*fakeRabbit
+	delay time.Duration
+}
+
+func (sr slowRabbit) ListQueues() ([]rabbithole.QueueInfo, error) {
+	time.Sleep(sr.delay)
+	return sr.fakeRabbit.ListQueues()
+}
+
+func TestCheckOnceCycleTimeoutHeroku(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.hs = slowHeroku{fakeHeroku: hs, delay: time.Second}
+	ds.CycleTimeout = 50 * time.Millisecond
+
+	var buf bytes.Buffer
+	ds.Logger.SetOutput(&buf)
+
+	start := time.Now()
+	err := ds.CheckOnce(context.Background())
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if !strings.Contains(err.Error(), "check exceeded CycleTimeout of 50ms") {
+		t.Errorf("expected error about CycleTimeout, got %s", err.Error())
+	}
+
+	if elapsed >= time.Second {
+		t.Errorf("expected check to be abandoned at the deadline, took %s", elapsed)
+	}
+
+	if n := len(hs.updateCalls()); n != 0 {
+		t.Errorf("expected no formation updates, got %d", n)
+	}
+
+	if !strings.Contains(buf.String(), "check exceeded CycleTimeout, abandoning it") {
+		t.Errorf("expected a warning about CycleTimeout, got %q", buf.String())
+	}
+}
+
+func TestCheckOnceCycleTimeoutRabbitMQ(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.rmqc = slowRabbit{fakeRabbit: rmqc, delay: time.Second}
+	ds.CycleTimeout = 50 * time.Millisecond
+	ds.Logger.SetOutput(&bytes.Buffer{})
+
+	start := time.Now()
+	err := ds.CheckOnce(context.Background())
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if elapsed >= time.Second {
+		t.Errorf("expected check to be abandoned at the deadline, took %s", elapsed)
+	}
+
+	if n := len(hs.updateCalls()); n != 0 {
+		t.Errorf("expected no formation updates, got %d", n)
+	}
+}
+
+func TestCheckOnceWithinCycleTimeout(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.CycleTimeout = time.Minute
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "bar", quantity: 1}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+}
+
+func TestThrottleSkipsScalingToCurrentQuantity(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "app")
+	ds.ScaleUpCooldown = time.Minute
+
+	var buf bytes.Buffer
+	ds.Logger.SetOutput(&buf)
+	ds.Logger.SetLevel(logrus.DebugLevel)
+
+	wc := WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "foo", WorkerType: "bar"}
+
+	// e.g. a target clamped back to the current quantity
+	ev := ds.throttle(wc, evaluation{
+		totalMsgs:   5,
+		oldQuantity: 2,
+		newQuantity: 2,
+		decision:    ScaleUp,
+	})
+
+	if ev.decision != NoChange {
+		t.Errorf("expected decision to be %s, got %s", NoChange, ev.decision)
+	}
+
+	if ds.prepare(wc, ev) {
+		t.Error("expected the dynos to not be scaled")
+	}
+
+	if ws := ds.state.worker("app", "bar"); !ws.lastScaleUp.IsZero() {
+		t.Errorf("expected no scale-up to be recorded, got %s", ws.lastScaleUp)
+	}
+
+	if !strings.Contains(buf.String(), "already running the new quantity, not scaling dynos") {
+		t.Errorf("expected the no-op to be logged, got %q", buf.String())
+	}
+}
+
+func TestCheckOnceSkipsFormationUpdateAtTarget(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 3}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 100}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 5},
+		MaxWorkers:      3,
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.Events = make(chan ScalingEvent, 1)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 0 {
+		t.Errorf("expected no formation updates, got %+v", updates)
+	}
+
+	if ev := <-ds.Events; ev.Decision.scales() || ev.Scaled {
+		t.Errorf("expected the worker to not be scaled, got %+v", ev)
+	}
+}
+
+func TestDesiredWorkerCountInterpolate(t *testing.T) {
+	cases := []struct {
+		backlog      int
+		stepped      int
+		interpolated int
+	}{
+		{0, 0, 0},
+		{5, 0, 0},
+		{10, 2, 2},
+		{11, 2, 3},
+		{20, 2, 4},
+		{29, 2, 5},
+		{30, 5, 5},
+		{100, 5, 5},
+	}
+
+	stepped := WorkerConfig{MsgWorkerRatios: map[int]int{10: 2, 30: 5}}
+	interpolated := stepped
+	interpolated.Interpolate = true
+
+	for _, c := range cases {
+		if n := desiredWorkerCount(stepped, c.backlog); n != c.stepped {
+			t.Errorf("stepped with %d messages: expected %d workers, got %d", c.backlog, c.stepped, n)
+		}
+
+		if n := desiredWorkerCount(interpolated, c.backlog); n != c.interpolated {
+			t.Errorf("interpolated with %d messages: expected %d workers, got %d", c.backlog, c.interpolated, n)
+		}
+	}
+}
+
+func TestDesiredWorkerCountInterpolateRoundingMode(t *testing.T) {
+	cases := map[RoundingMode]int{RoundUp: 4, RoundDown: 3, RoundNearest: 4}
+
+	for mode, expected := range cases {
+		wc := WorkerConfig{MsgWorkerRatios: map[int]int{10: 2, 30: 5}, Interpolate: true, RoundingMode: mode}
+
+		// 3.5 workers
+		if n := desiredWorkerCount(wc, 20); n != expected {
+			t.Errorf("%s with 20 messages: expected %d workers, got %d", mode, expected, n)
+		}
+	}
+}
+
+func TestCheckScalingInterpolateRespectsMaxWorkers(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{10: 2, 30: 5},
+			Interpolate:     true,
+			MinWorkers:      1,
+			MaxWorkers:      3,
+			QueueName:       "foo",
+			WorkerType:      "bar",
+		},
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 20}},
+		[]heroku.Formation{{Type: "bar", Quantity: 1}},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 3 {
+		t.Errorf("expected newQuantity to be 3, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+}
+
+// omittingRabbit is a fakeRabbit which leaves out all of the queues
+// from its first omit listings.
+type omittingRabbit struct {
+	*fakeRabbit
+	omit int
+}
+
+func (om *omittingRabbit) ListQueues() ([]rabbithole.QueueInfo, error) {
+	queues, err := om.fakeRabbit.ListQueues()
+	if om.omit > 0 {
+		om.omit--
+		return nil, err
+	}
+
+	return queues, err
+}
+
+func TestCheckOnceQueueLookupRetries(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.rmqc = &omittingRabbit{fakeRabbit: rmqc, omit: 1}
+	ds.QueueLookupRetries = 2
+	ds.Logger.SetOutput(&bytes.Buffer{})
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if rmqc.calls != 2 {
+		t.Errorf("expected the queues to be listed 2 times, got %d", rmqc.calls)
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "bar", quantity: 1}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+}
+
+func TestCheckOnceQueueLookupRetriesExhausted(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.rmqc = &omittingRabbit{fakeRabbit: rmqc, omit: 3}
+	ds.QueueLookupRetries = 2
+	ds.Logger.SetOutput(&bytes.Buffer{})
+
+	err := ds.CheckOnce(context.Background())
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected error about the missing queue, got %s", err.Error())
+	}
+
+	if rmqc.calls != 3 {
+		t.Errorf("expected the queues to be listed 3 times, got %d", rmqc.calls)
+	}
+}
+
+func TestCheckOnceWithoutQueueLookupRetries(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "other", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.Logger.SetOutput(&bytes.Buffer{})
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if rmqc.calls != 1 {
+		t.Errorf("expected the queues to be listed once, got %d", rmqc.calls)
 	}
 }
@@ -0,0 +1,52 @@
+package dynoscaler
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// WorkersEnv is the name of the environment variable holding the
+// JSON-encoded list of worker configs for NewDynoScalerFromEnv.
+const WorkersEnv = "DYNOSCALER_WORKERS"
+
+// NewDynoScalerFromEnv initializes a new DynoScaler using the
+// environment variables RABBITMQ_HOST, RABBITMQ_USERNAME,
+// RABBITMQ_PASSWORD, HEROKU_API_KEY and HEROKU_APP, as well as
+// DYNOSCALER_WORKERS for the worker configs, for example:
+//
+//	DYNOSCALER_WORKERS='[{"queue_name": "bar", "worker_type": "mainworker", "msg_worker_ratios": {"1": 1, "10": 2}}]'
+//
+// An error is returned if any of the variables is missing.
+func NewDynoScalerFromEnv() (DynoScaler, error) {
+	var cfg Config
+	var missing []string
+
+	lookup := func(name string) string {
+		value := os.Getenv(name)
+		if value == "" {
+			missing = append(missing, name)
+		}
+
+		return value
+	}
+
+	cfg.RabbitMQ.Host = lookup("RABBITMQ_HOST")
+	cfg.RabbitMQ.Username = lookup("RABBITMQ_USERNAME")
+	cfg.RabbitMQ.Password = lookup("RABBITMQ_PASSWORD")
+	cfg.Heroku.APIKey = lookup("HEROKU_API_KEY")
+	cfg.Heroku.App = lookup("HEROKU_APP")
+	workers := lookup(WorkersEnv)
+
+	if len(missing) > 0 {
+		return DynoScaler{}, errors.Errorf("missing environment variables: %s", strings.Join(missing, ", "))
+	}
+
+	if err := json.Unmarshal([]byte(workers), &cfg.Workers); err != nil {
+		return DynoScaler{}, errors.Wrapf(err, "failed to parse %s", WorkersEnv)
+	}
+
+	return NewDynoScalerFromConfig(cfg), nil
+}
@@ -0,0 +1,84 @@
+package dynoscaler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func setDynoScalerEnv(t *testing.T) {
+	t.Setenv("RABBITMQ_HOST", "baboon.rmq.cloudamqp.com")
+	t.Setenv("RABBITMQ_USERNAME", "username")
+	t.Setenv("RABBITMQ_PASSWORD", "password")
+	t.Setenv("HEROKU_API_KEY", "apikey")
+	t.Setenv("HEROKU_APP", "app")
+	t.Setenv(WorkersEnv, `[
+		{"queue_name": "foo", "worker_type": "fooworker", "msg_worker_ratios": {"1": 1}},
+		{"queue_name": "bar", "worker_type": "mainworker", "ratio_mode": "publish_rate", "max_workers": 5, "msg_worker_ratios": {"1": 1, "10": 2}}
+	]`)
+}
+
+func TestNewDynoScalerFromEnv(t *testing.T) {
+	setDynoScalerEnv(t)
+
+	ds, err := NewDynoScalerFromEnv()
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ds.rabbitMQHost != "baboon.rmq.cloudamqp.com" || ds.rabbitMQUsername != "username" || ds.rabbitMQPassword != "password" {
+		t.Error("expected RabbitMQ settings to be set")
+	}
+
+	if ds.herokuAPIKey != "apikey" || ds.herokuAppID != "app" {
+		t.Error("expected Heroku settings to be set")
+	}
+
+	expected := []WorkerConfig{
+		{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			RatioMode:       RatioByPublishRate,
+			MaxWorkers:      5,
+			QueueName:       "bar",
+			WorkerType:      "mainworker",
+		},
+	}
+
+	if !reflect.DeepEqual(ds.workerConfigs, expected) {
+		t.Errorf("expected worker configs to be %+v, got %+v", expected, ds.workerConfigs)
+	}
+}
+
+func TestNewDynoScalerFromEnvMissing(t *testing.T) {
+	setDynoScalerEnv(t)
+	t.Setenv("RABBITMQ_PASSWORD", "")
+	t.Setenv("HEROKU_APP", "")
+
+	_, err := NewDynoScalerFromEnv()
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if !strings.Contains(err.Error(), "RABBITMQ_PASSWORD, HEROKU_APP") {
+		t.Errorf("expected error to name the missing variables, got %s", err.Error())
+	}
+}
+
+func TestNewDynoScalerFromEnvInvalidWorkers(t *testing.T) {
+	setDynoScalerEnv(t)
+	t.Setenv(WorkersEnv, `{"queue_name": "foo"}`)
+
+	_, err := NewDynoScalerFromEnv()
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if !strings.Contains(err.Error(), WorkersEnv) {
+		t.Errorf("expected error to mention %s, got %s", WorkersEnv, err.Error())
+	}
+}
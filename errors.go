@@ -0,0 +1,100 @@
+package dynoscaler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrQueueNotFound is matched by errors.Is when a queue tracked by a
+// worker config is not in the RabbitMQ data. The error is a
+// *QueueNotFoundError, which errors.As extracts the queue from.
+var ErrQueueNotFound = errors.New("unable to find queue info from RabbitMQ data")
+
+// ErrFormationNotFound is matched by errors.Is when the WorkerType of
+// a worker config is not a process type of the Heroku app. The error
+// is a *FormationNotFoundError, which errors.As extracts the worker
+// type from.
+var ErrFormationNotFound = errors.New("unable to find formation info from Heroku data")
+
+// QueueNotFoundError is returned when a queue tracked by a worker
+// config is not in the RabbitMQ data.
+type QueueNotFoundError struct {
+	// The missing queue, empty if the worker config doesn't track any.
+	Queue string
+}
+
+func (e *QueueNotFoundError) Error() string {
+	if e.Queue == "" {
+		return ErrQueueNotFound.Error()
+	}
+
+	return fmt.Sprintf("unable to find queue info of %s from RabbitMQ data", e.Queue)
+}
+
+// Is makes the error match ErrQueueNotFound.
+func (e *QueueNotFoundError) Is(target error) bool {
+	return target == ErrQueueNotFound
+}
+
+// FormationNotFoundError is returned when the WorkerType of a worker
+// config is not a process type of the Heroku app.
+type FormationNotFoundError struct {
+	WorkerType string
+}
+
+func (e *FormationNotFoundError) Error() string {
+	return fmt.Sprintf("unable to find formation info of %s from Heroku data", e.WorkerType)
+}
+
+// Is makes the error match ErrFormationNotFound.
+func (e *FormationNotFoundError) Is(target error) bool {
+	return target == ErrFormationNotFound
+}
+
+// multiError combines several errors into a single one.
+type multiError []error
+
+func (me multiError) Error() string {
+	msgs := make([]string, len(me))
+	for i, err := range me {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the errors matches target, so that
+// errors.Is sees through the combined error.
+func (me multiError) Is(target error) bool {
+	for _, err := range me {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first of the errors that matches target, like
+// errors.As does for a single error.
+func (me multiError) As(target interface{}) bool {
+	for _, err := range me {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errOrNil returns nil when there are no errors, so that an
+// empty multiError never ends up as a non-nil error value.
+func (me multiError) errOrNil() error {
+	if len(me) == 0 {
+		return nil
+	}
+
+	return me
+}
@@ -0,0 +1,49 @@
+package dynoscaler
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMultiErrorEmpty(t *testing.T) {
+	var errs multiError
+
+	if err := errs.errOrNil(); err != nil {
+		t.Errorf("expected error to be nil, got %s", err.Error())
+	}
+}
+
+func TestMultiErrorMessage(t *testing.T) {
+	errs := multiError{errors.New("foo"), errors.New("bar")}
+
+	err := errs.errOrNil()
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if err.Error() != "foo; bar" {
+		t.Errorf("expected error to be \"foo; bar\", got %q", err.Error())
+	}
+}
+
+func TestMultiErrorIsAndAs(t *testing.T) {
+	errs := multiError{
+		errors.New("foo"),
+		fmt.Errorf("failed to check scaling of bar: %w", &FormationNotFoundError{WorkerType: "bar"}),
+	}
+
+	err := errs.errOrNil()
+	if !errors.Is(err, ErrFormationNotFound) {
+		t.Errorf("expected %q to match ErrFormationNotFound", err.Error())
+	}
+
+	if errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("expected %q to not match ErrQueueNotFound", err.Error())
+	}
+
+	var missing *FormationNotFoundError
+	if !errors.As(err, &missing) || missing.WorkerType != "bar" {
+		t.Errorf("expected a FormationNotFoundError of bar, got %#v", missing)
+	}
+}
@@ -0,0 +1,48 @@
+package dynoscaler
+
+import "time"
+
+// ScalingEvent describes the outcome of checking a single worker config.
+type ScalingEvent struct {
+	// The Heroku app the process runs in.
+	HerokuApp string
+
+	// The process on Heroku that was checked.
+	WorkerType string
+
+	// The queue(s) tracked by the worker config, separated by commas.
+	QueueName string
+
+	// Number of dynos before the check.
+	OldQuantity int
+
+	// Number of dynos the worker should be running after the check.
+	// Equals OldQuantity if no scaling was necessary.
+	NewQuantity int
+
+	// The queue metric that was compared to MsgWorkerRatios, which is
+	// the total number of queued and unacked messages by default.
+	TotalMessages int
+
+	// When the worker config was checked.
+	Time time.Time
+
+	// Why the worker was or wasn't scaled.
+	Decision Decision
+
+	// Whether the Heroku formation was actually updated.
+	Scaled bool
+}
+
+// emit sends ev on ds.Events, unless it is nil or full.
+func (ds *DynoScaler) emit(ev ScalingEvent) {
+	if ds.Events == nil {
+		return
+	}
+
+	select {
+	case ds.Events <- ev:
+	default:
+		ds.log.WithField("worker_type", ev.WorkerType).Debug("events channel is full, dropping scaling event")
+	}
+}
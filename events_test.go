@@ -0,0 +1,112 @@
+package dynoscaler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+func TestCheckOnceEmitsEvents(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{
+			{Type: "fooworker", Quantity: 0},
+			{Type: "barworker", Quantity: 2},
+		},
+	}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{
+			{Name: "foo", Messages: 10},
+			{Name: "bar", Messages: 0},
+		},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+	ds.now = func() time.Time { return now }
+	ds.Events = make(chan ScalingEvent, 2)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []ScalingEvent{
+		{
+			HerokuApp:     "app",
+			WorkerType:    "fooworker",
+			QueueName:     "foo",
+			OldQuantity:   0,
+			NewQuantity:   2,
+			TotalMessages: 10,
+			Time:          now,
+			Decision:      ScaleUp,
+			Scaled:        true,
+		},
+		{
+			HerokuApp:     "app",
+			WorkerType:    "barworker",
+			QueueName:     "bar",
+			OldQuantity:   2,
+			NewQuantity:   0,
+			TotalMessages: 0,
+			Time:          now,
+			Decision:      ScaleDown,
+			Scaled:        true,
+		},
+	}
+
+	for _, e := range expected {
+		select {
+		case ev := <-ds.Events:
+			if ev != e {
+				t.Errorf("expected event to be %+v, got %+v", e, ev)
+			}
+		default:
+			t.Fatalf("expected an event for %s", e.WorkerType)
+		}
+	}
+}
+
+func TestCheckOnceDropsEventsWhenFull(t *testing.T) {
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{{Type: "bar", Quantity: 0}},
+	}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.Events = make(chan ScalingEvent)
+
+	done := make(chan error)
+	go func() {
+		done <- ds.CheckOnce(context.Background())
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected CheckOnce to not block on a full events channel")
+	}
+}
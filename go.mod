@@ -8,7 +8,11 @@ require (
 	github.com/onsi/ginkgo v1.7.0 // indirect
 	github.com/onsi/gomega v1.4.3 // indirect
 	github.com/pborman/uuid v1.2.0 // indirect
-	github.com/pkg/errors v0.8.1
+	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.1.0
+	github.com/prometheus/client_model v0.0.0-20190129233127-fd36f4220a90
+	github.com/prometheus/common v0.6.0
 	github.com/sirupsen/logrus v1.3.0
 	github.com/streadway/amqp v0.0.0-20181205114330-a314942b2fd9 // indirect
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,109 @@
+package dynoscaler
+
+import (
+	"context"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	"github.com/sirupsen/logrus"
+)
+
+// started returns when the scaler was started, which is the first call
+// of MonitorContext or the first check, whichever happens first.
+func (ds *DynoScaler) started() time.Time {
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	if ds.state.startedAt.IsZero() {
+		ds.state.startedAt = ds.now()
+	}
+
+	return ds.state.startedAt
+}
+
+// startedAt returns when the scaler was started, or zero if it hasn't
+// been started yet. Unlike started, it never starts the scaler.
+func (ds *DynoScaler) startedAt() time.Time {
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	return ds.state.startedAt
+}
+
+// holdDuringGrace holds the scalings of the checked evaluations within
+// the PostDeployGrace, if set, after the scaler was started or the
+// latest release of their app was created. The releases are only
+// listed for the apps with a scaling to hold, and failing to list them
+// only leaves the grace after the start. While planning, a scaler
+// which hasn't been started yet is taken to be starting now.
+func (ds *DynoScaler) holdDuringGrace(ctx context.Context, configs []int, evs []evaluation, checked []bool, planning bool) {
+	if ds.PostDeployGrace <= 0 {
+		return
+	}
+
+	now := ds.now()
+	since := now
+	if !planning {
+		since = ds.started()
+	} else if at := ds.startedAt(); !at.IsZero() {
+		since = at
+	}
+
+	released := make(map[string]time.Time)
+	for j := range evs {
+		if !checked[j] || !evs[j].decision.scales() {
+			continue
+		}
+
+		wc := ds.workerConfigs[configs[j]]
+		app := ds.appOf(wc)
+
+		at, ok := released[app]
+		if !ok {
+			at = ds.latestRelease(ctx, app)
+			released[app] = at
+		}
+
+		if at.Before(since) {
+			at = since
+		}
+
+		if now.Sub(at) >= ds.PostDeployGrace {
+			continue
+		}
+
+		logHold(ds.log.WithFields(logrus.Fields{
+			"heroku_app":   app,
+			"worker_type":  wc.WorkerType,
+			"new_quantity": evs[j].newQuantity,
+			"grace_left":   ds.PostDeployGrace - now.Sub(at),
+		}), planning, "within PostDeployGrace, not scaling dynos")
+
+		evs[j].decision = Hold
+		evs[j].newQuantity = evs[j].oldQuantity
+	}
+}
+
+// latestRelease returns when the latest release of app was created,
+// zero if it can't be told, e.g. with a custom Scaler.
+func (ds *DynoScaler) latestRelease(ctx context.Context, app string) time.Time {
+	if ds.Scaler != nil {
+		return time.Time{}
+	}
+
+	releases, err := ds.hs.ReleaseList(ctx, app, &heroku.ListRange{Field: "version", Descending: true, Max: 1})
+	if err != nil {
+		ds.observeHerokuError(err)
+		ds.log.WithError(err).WithField("heroku_app", app).Warn("failed to list Heroku releases")
+		return time.Time{}
+	}
+
+	var latest time.Time
+	for _, r := range releases {
+		if r.CreatedAt.After(latest) {
+			latest = r.CreatedAt
+		}
+	}
+
+	return latest
+}
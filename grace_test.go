@@ -0,0 +1,122 @@
+package dynoscaler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+func TestCheckOncePostDeployGraceAfterStart(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.now = func() time.Time { return now }
+	ds.PostDeployGrace = 5 * time.Minute
+
+	for _, after := range []time.Duration{0, time.Minute, 3 * time.Minute} {
+		now = now.Add(after)
+
+		if err := ds.CheckOnce(context.Background()); err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if updates := hs.updateCalls(); len(updates) != 0 {
+			t.Fatalf("expected no scaling %s into the grace, got %+v", now.Sub(ds.started()), updates)
+		}
+	}
+
+	if status := ds.Snapshot()[0]; status.TotalMessages != 10 || status.LastChecked.IsZero() {
+		t.Errorf("expected the checks to still be observed, got %+v", status)
+	}
+
+	now = now.Add(time.Minute)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "bar", quantity: 2}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates after the grace to be %+v, got %+v", expected, updates)
+	}
+}
+
+func TestCheckOncePostDeployGraceAfterRelease(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.now = func() time.Time { return now }
+	ds.PostDeployGrace = 5 * time.Minute
+	ds.Logger.SetOutput(&bytes.Buffer{})
+
+	// long done with the grace after the start
+	ds.state.startedAt = now.Add(-time.Hour)
+	hs.releases = []heroku.Release{{CreatedAt: now.Add(-2 * time.Minute)}}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 0 {
+		t.Fatalf("expected no scaling right after the release, got %+v", updates)
+	}
+
+	now = now.Add(3 * time.Minute)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "bar", quantity: 2}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates after the grace to be %+v, got %+v", expected, updates)
+	}
+}
+
+func TestCheckOncePostDeployGraceReleaseListFails(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	hs := &fakeHeroku{
+		formations:     []heroku.Formation{{Type: "bar", Quantity: 0}},
+		releaseListErr: errors.New("unavailable"),
+	}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.now = func() time.Time { return now }
+	ds.PostDeployGrace = 5 * time.Minute
+	ds.state.startedAt = now.Add(-time.Hour)
+	ds.Logger.SetOutput(&bytes.Buffer{})
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 1 {
+		t.Errorf("expected the check to scale regardless, got %+v", updates)
+	}
+}
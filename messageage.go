@@ -0,0 +1,147 @@
+package dynoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// messageAger is implemented by the rabbitClients which can tell when
+// the message at the head of a queue was published. The rabbithole
+// client doesn't, so the Management API is called directly for it.
+type messageAger interface {
+	// HeadMessageTimestamp returns the timestamp of the oldest message
+	// of the queue, and false if the queue is empty or the message
+	// has no timestamp.
+	HeadMessageTimestamp(ctx context.Context, vhost, queue string) (time.Time, bool, error)
+}
+
+// stale reports whether the oldest message of a queue of qc is older
+// than its MaxMessageAge, if qc uses RatioByMessageAge. Failing to tell
+// is logged, and doesn't count as stale, just like the queues whose
+// age can't be told before ctx is done.
+func (ds *DynoScaler) stale(ctx context.Context, qc WorkerConfig, queues []rabbithole.QueueInfo) bool {
+	if qc.RatioMode != RatioByMessageAge || qc.MaxMessageAge <= 0 {
+		return false
+	}
+
+	for _, qi := range trackedQueues(qc, queues) {
+		if qi.Messages == 0 {
+			continue
+		}
+
+		head, ok, err := ds.headMessageTimestamp(ctx, qc.RabbitMQCluster, qi.Vhost, qi.Name)
+		if err != nil {
+			ds.log.WithError(err).WithFields(logrus.Fields{
+				"heroku_app":  ds.appOf(qc),
+				"worker_type": qc.WorkerType,
+				"queue":       qi.Name,
+			}).Warn("failed to get the age of the oldest message")
+			continue
+		}
+
+		if ok && ds.now().Sub(head) > qc.MaxMessageAge {
+			ds.log.WithFields(logrus.Fields{
+				"heroku_app":  ds.appOf(qc),
+				"worker_type": qc.WorkerType,
+				"queue":       qi.Name,
+				"age":         ds.now().Sub(head),
+			}).Info("oldest message exceeds MaxMessageAge")
+			return true
+		}
+	}
+
+	return false
+}
+
+// trackedQueues returns the queues tracked by qc, by name or by its
+// QueueNamePattern.
+func trackedQueues(qc WorkerConfig, queues []rabbithole.QueueInfo) []rabbithole.QueueInfo {
+	names := make(map[string]bool)
+	for _, name := range qc.queueNames() {
+		names[name] = true
+	}
+
+	var re *regexp.Regexp
+	if qc.QueueNamePattern != "" {
+		// an invalid pattern already fails combinedQueueInfo
+		re, _ = regexp.Compile(qc.QueueNamePattern)
+	}
+
+	var tracked []rabbithole.QueueInfo
+	for _, qi := range queues {
+		if names[qi.Name] || re != nil && re.MatchString(qi.Name) {
+			tracked = append(tracked, qi)
+		}
+	}
+
+	return tracked
+}
+
+// headMessageTimestamp returns the timestamp of the oldest message of
+// the queue in the RabbitMQ cluster with the given name, using the
+// RabbitMQ client if it can tell, and the RabbitMQ Management API
+// otherwise. The request is cancelled once ctx is done.
+func (ds *DynoScaler) headMessageTimestamp(ctx context.Context, cluster, vhost, queue string) (time.Time, bool, error) {
+	c, err := ds.cluster(cluster)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	if ager, ok := c.client.(messageAger); ok {
+		return ager.HeadMessageTimestamp(ctx, vhost, queue)
+	}
+
+	client := &http.Client{Timeout: ds.RabbitMQTimeout}
+	if ds.RabbitMQTransport != nil {
+		client.Transport = ds.RabbitMQTransport
+	}
+
+	if vhost == "" {
+		vhost = "/"
+	}
+
+	u := fmt.Sprintf(
+		"%s/api/queues/%s/%s?columns=head_message_timestamp",
+		strings.TrimSuffix(ds.managementURL(c.host), "/"), url.PathEscape(vhost), url.PathEscape(queue),
+	)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	req.SetBasicAuth(c.username, c.password)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return time.Time{}, false, errors.Errorf("error %d from RabbitMQ", res.StatusCode)
+	}
+
+	var info struct {
+		// seconds since the epoch, missing while the queue is empty
+		HeadMessageTimestamp *int64 `json:"head_message_timestamp"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return time.Time{}, false, errors.Wrap(err, "failed to decode queue info")
+	}
+
+	if info.HeadMessageTimestamp == nil {
+		return time.Time{}, false, nil
+	}
+
+	return time.Unix(*info.HeadMessageTimestamp, 0), true, nil
+}
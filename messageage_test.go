@@ -0,0 +1,166 @@
+package dynoscaler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+func TestCheckOnceMaxMessageAge(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		head     time.Time
+		expected []formationUpdate
+	}{
+		{"stale", now.Add(-2 * time.Hour), []formationUpdate{{app: "app", workerType: "bar", quantity: 2}}},
+		{"fresh", now.Add(-time.Minute), nil},
+	}
+
+	for _, c := range cases {
+		hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 1}}}
+		rmqc := &fakeRabbit{
+			queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 5}},
+			heads:  map[string]time.Time{"foo": c.head},
+		}
+
+		ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 50: 2},
+			RatioMode:       RatioByMessageAge,
+			MaxMessageAge:   time.Hour,
+			QueueName:       "foo",
+			WorkerType:      "bar",
+		})
+		ds.now = func() time.Time { return now }
+		ds.Logger.SetOutput(&bytes.Buffer{})
+
+		if err := ds.CheckOnce(context.Background()); err != nil {
+			t.Fatalf("%s: expected error to be nil, got %s", c.name, err.Error())
+		}
+
+		if updates := hs.updateCalls(); !reflect.DeepEqual(updates, c.expected) {
+			t.Errorf("%s: expected formation updates to be %+v, got %+v", c.name, c.expected, updates)
+		}
+	}
+}
+
+func TestCheckScalingMaxMessageAgeRespectsMaxWorkers(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	ds := NewDynoScaler("", "", "", "", "")
+	ds.now = func() time.Time { return now }
+	ds.rmqc = &fakeRabbit{heads: map[string]time.Time{"foo": now.Add(-2 * time.Hour)}}
+	ds.Logger.SetOutput(&bytes.Buffer{})
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			RatioMode:       RatioByMessageAge,
+			MaxMessageAge:   time.Hour,
+			MaxWorkers:      2,
+			QueueName:       "foo",
+			WorkerType:      "bar",
+		},
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 5}},
+		[]heroku.Formation{{Type: "bar", Quantity: 2}},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.Scaled {
+		t.Errorf("expected scale to be false at MaxWorkers, got %d", ev.NewQuantity)
+	}
+}
+
+func TestHeadMessageTimestampManagementAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "username" || pass != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.EscapedPath() {
+		case "/api/queues/%2F/foo":
+			fmt.Fprint(w, `{"name": "foo", "head_message_timestamp": 1546300800}`)
+		case "/api/queues/%2F/empty":
+			fmt.Fprint(w, `{"name": "empty", "head_message_timestamp": null}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ds := NewDynoScaler(server.URL, "username", "password", "", "app")
+	ds.hs = &fakeHeroku{}
+	if err := ds.initClients(); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	head, ok, err := ds.headMessageTimestamp(context.Background(), "", "/", "foo")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if expected := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC); !ok || !head.Equal(expected) {
+		t.Errorf("expected head message timestamp to be %s, got %s (%t)", expected, head, ok)
+	}
+
+	if _, ok, err := ds.headMessageTimestamp(context.Background(), "", "/", "empty"); err != nil || ok {
+		t.Errorf("expected no head message timestamp for an empty queue, got %t, %v", ok, err)
+	}
+
+	if _, _, err := ds.headMessageTimestamp(context.Background(), "", "/", "missing"); err == nil {
+		t.Error("expected error to not be nil for a missing queue")
+	}
+}
+
+// listingRabbit is a rabbitClient which can only list, so that the age
+// of the messages is asked from the RabbitMQ Management API.
+type listingRabbit struct {
+	rabbitClient
+}
+
+func TestCheckOnceMaxMessageAgeCycleTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+			fmt.Fprint(w, `{"name": "foo", "head_message_timestamp": 1546300800}`)
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 1}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 5}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		RatioMode:       RatioByMessageAge,
+		MaxMessageAge:   time.Hour,
+		MaxWorkers:      2,
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.rabbitMQHost = server.URL
+	ds.rmqc = listingRabbit{rmqc}
+	ds.CycleTimeout = 50 * time.Millisecond
+	ds.Logger.SetOutput(&bytes.Buffer{})
+
+	start := time.Now()
+	_ = ds.CheckOnce(context.Background())
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the age of the messages to be abandoned with the check, took %s", elapsed)
+	}
+}
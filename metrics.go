@@ -0,0 +1,129 @@
+package dynoscaler
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// metrics holds the Prometheus collectors of a DynoScaler.
+type metrics struct {
+	queueBacklog    *prometheus.GaugeVec
+	currentQuantity *prometheus.GaugeVec
+	desiredQuantity *prometheus.GaugeVec
+	scaleEvents     *prometheus.CounterVec
+	callDuration    *prometheus.HistogramVec
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		queueBacklog: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "dynoscaler",
+			Name:      "queue_backlog",
+			Help:      "The queue metric compared to the message-worker ratios, the number of queued and unacked messages by default.",
+		}, []string{"heroku_app", "worker_type", "queue"}),
+		currentQuantity: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "dynoscaler",
+			Name:      "current_workers",
+			Help:      "The number of dynos in the Heroku formation.",
+		}, []string{"heroku_app", "worker_type"}),
+		desiredQuantity: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "dynoscaler",
+			Name:      "desired_workers",
+			Help:      "The number of dynos the worker should be running.",
+		}, []string{"heroku_app", "worker_type"}),
+		scaleEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "dynoscaler",
+			Name:      "scale_events_total",
+			Help:      "The number of times the Heroku formation has been scaled.",
+		}, []string{"heroku_app", "worker_type", "direction"}),
+		callDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "dynoscaler",
+			Name:      "external_call_duration_seconds",
+			Help:      "How long the calls to the RabbitMQ Management API and the Heroku Platform API take.",
+		}, []string{"call"}),
+	}
+}
+
+// RegisterMetrics registers the Prometheus metrics of the scaler with
+// reg, after which they are updated on every check. This includes the
+// backlog of each worker config, the current and desired number of
+// dynos of each worker type, the number of scale-ups and -downs, and
+// how long the calls listing the queues and the formations and updating
+// the formations take.
+func (ds *DynoScaler) RegisterMetrics(reg prometheus.Registerer) error {
+	m := newMetrics()
+
+	for _, c := range []prometheus.Collector{
+		m.queueBacklog,
+		m.currentQuantity,
+		m.desiredQuantity,
+		m.scaleEvents,
+		m.callDuration,
+	} {
+		if err := reg.Register(c); err != nil {
+			return errors.Wrap(err, "failed to register metrics")
+		}
+	}
+
+	ds.metrics = m
+
+	return nil
+}
+
+// observeCall logs how long the external call which started at start
+// took, and records it in the metrics, so that slow checks can be
+// traced back to RabbitMQ or Heroku. The time is measured with the
+// wall clock, regardless of ds.now.
+func (ds *DynoScaler) observeCall(call string, start time.Time) {
+	d := time.Since(start)
+
+	ds.log.WithFields(logrus.Fields{
+		"call":     call,
+		"duration": d,
+	}).Debug("external call completed")
+
+	ds.metrics.observeCall(call, d)
+}
+
+// observeBacklog updates the backlog of wc in app alone, for a worker
+// config which couldn't be checked.
+func (m *metrics) observeBacklog(app string, wc WorkerConfig, queueName string, backlog int) {
+	if m == nil {
+		return
+	}
+
+	m.queueBacklog.WithLabelValues(app, wc.WorkerType, queueName).Set(float64(backlog))
+}
+
+// observeCall records that the external call took d.
+func (m *metrics) observeCall(call string, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.callDuration.WithLabelValues(call).Observe(d.Seconds())
+}
+
+// observe updates the metrics with the outcome of checking wc in app.
+func (m *metrics) observe(app string, wc WorkerConfig, ev evaluation, scaled bool) {
+	if m == nil {
+		return
+	}
+
+	m.queueBacklog.WithLabelValues(app, wc.WorkerType, ev.queueName).Set(float64(ev.totalMsgs))
+	m.currentQuantity.WithLabelValues(app, wc.WorkerType).Set(float64(ev.oldQuantity))
+	m.desiredQuantity.WithLabelValues(app, wc.WorkerType).Set(float64(ev.newQuantity))
+
+	if !scaled {
+		return
+	}
+
+	if ev.newQuantity > ev.oldQuantity {
+		m.scaleEvents.WithLabelValues(app, wc.WorkerType, "up").Inc()
+	} else {
+		m.scaleEvents.WithLabelValues(app, wc.WorkerType, "down").Inc()
+	}
+}
@@ -0,0 +1,148 @@
+package dynoscaler
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{
+			{Type: "fooworker", Quantity: 1},
+			{Type: "barworker", Quantity: 2},
+		},
+	}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{
+			{Name: "foo", Messages: 8, MessagesUnacknowledged: 2},
+			{Name: "bar", Messages: 0},
+		},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+
+	reg := prometheus.NewRegistry()
+	if err := ds.RegisterMetrics(reg); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	for _, tc := range []struct {
+		name     string
+		c        prometheus.Collector
+		expected float64
+	}{
+		{"foo backlog", ds.metrics.queueBacklog.WithLabelValues("app", "fooworker", "foo"), 10},
+		{"bar backlog", ds.metrics.queueBacklog.WithLabelValues("app", "barworker", "bar"), 0},
+		{"fooworker current", ds.metrics.currentQuantity.WithLabelValues("app", "fooworker"), 1},
+		{"fooworker desired", ds.metrics.desiredQuantity.WithLabelValues("app", "fooworker"), 3},
+		{"barworker current", ds.metrics.currentQuantity.WithLabelValues("app", "barworker"), 2},
+		{"barworker desired", ds.metrics.desiredQuantity.WithLabelValues("app", "barworker"), 0},
+		{"fooworker scale-ups", ds.metrics.scaleEvents.WithLabelValues("app", "fooworker", "up"), 1},
+		{"barworker scale-downs", ds.metrics.scaleEvents.WithLabelValues("app", "barworker", "down"), 1},
+	} {
+		if v := testutil.ToFloat64(tc.c); v != tc.expected {
+			t.Errorf("expected %s to be %v, got %v", tc.name, tc.expected, v)
+		}
+	}
+}
+
+func TestRegisterMetricsTwice(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	reg := prometheus.NewRegistry()
+	if err := ds.RegisterMetrics(reg); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if err := ds.RegisterMetrics(reg); err == nil {
+		t.Error("expected error to not be nil")
+	}
+}
+
+func TestRegisterMetricsCallDuration(t *testing.T) {
+	const delay = 20 * time.Millisecond
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 1}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.hs = slowHeroku{fakeHeroku: hs, delay: delay}
+	ds.rmqc = slowRabbit{fakeRabbit: rmqc, delay: delay}
+
+	var buf bytes.Buffer
+	ds.Logger.SetOutput(&buf)
+	ds.Logger.SetLevel(logrus.DebugLevel)
+
+	reg := prometheus.NewRegistry()
+	if err := ds.RegisterMetrics(reg); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	durations := make(map[string]float64)
+	for _, mf := range families {
+		if mf.GetName() != "dynoscaler_external_call_duration_seconds" {
+			continue
+		}
+
+		for _, m := range mf.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "call" {
+					durations[label.GetValue()] = m.GetHistogram().GetSampleSum()
+				}
+			}
+		}
+	}
+
+	for _, call := range []string{"ListQueues", "FormationList"} {
+		if d, ok := durations[call]; !ok || d < delay.Seconds() {
+			t.Errorf("expected %s to take at least %s, got %vs", call, delay, d)
+		}
+	}
+
+	if _, ok := durations["FormationUpdate"]; !ok {
+		t.Error("expected the duration of FormationUpdate to be recorded")
+	}
+
+	for _, call := range []string{"ListQueues", "FormationList", "FormationUpdate"} {
+		if !strings.Contains(buf.String(), "call="+call) {
+			t.Errorf("expected the duration of %s to be logged, got %s", call, buf.String())
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package dynoscaler
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Option configures a DynoScaler in NewDynoScaler. A WorkerConfig is
+// an Option as well, which adds the worker config to the DynoScaler.
+type Option interface {
+	configure(ds *DynoScaler)
+}
+
+// optionFunc is an Option which calls itself.
+type optionFunc func(ds *DynoScaler)
+
+func (f optionFunc) configure(ds *DynoScaler) {
+	f(ds)
+}
+
+func (wc WorkerConfig) configure(ds *DynoScaler) {
+	ds.workerConfigs = append(ds.workerConfigs, wc)
+}
+
+// New initializes a new DynoScaler like NewDynoScaler, but takes all of
+// its settings as options, e.g. WithRabbitMQ and WithHeroku, so that the
+// credentials can't be mixed up by their position.
+func New(opts ...Option) DynoScaler {
+	return NewDynoScaler("", "", "", "", "", opts...)
+}
+
+// WithRabbitMQ sets the RabbitMQ Management API to list the queues
+// from, as NewDynoScaler does with its first three arguments.
+func WithRabbitMQ(host, username, password string) Option {
+	return optionFunc(func(ds *DynoScaler) {
+		ds.rabbitMQHost = host
+		ds.rabbitMQUsername = username
+		ds.rabbitMQPassword = password
+	})
+}
+
+// WithRabbitMQCluster adds another RabbitMQ Management API to list the
+// queues from, for queues sharded across several clusters. The worker
+// configs whose RabbitMQCluster is name track the queues of it, while
+// the others keep tracking the queues of the RabbitMQ given to
+// NewDynoScaler. The Vhost, RabbitMQPort, RabbitMQTransport and
+// RabbitMQTimeout apply to all of the clusters, but a QueueSource only
+// replaces the RabbitMQ given to NewDynoScaler.
+func WithRabbitMQCluster(name, host, username, password string) Option {
+	return optionFunc(func(ds *DynoScaler) {
+		if ds.clusters == nil {
+			ds.clusters = make(map[string]*rabbitMQCluster)
+		}
+
+		ds.clusters[name] = &rabbitMQCluster{
+			host:     host,
+			username: username,
+			password: password,
+		}
+	})
+}
+
+// WithHeroku sets the Heroku Platform API key and the app to scale,
+// as NewDynoScaler does with its last two arguments.
+func WithHeroku(apiKey, app string) Option {
+	return optionFunc(func(ds *DynoScaler) {
+		ds.herokuAPIKey = apiKey
+		ds.herokuAppID = app
+	})
+}
+
+// WithWorkerConfig adds the worker config, just like passing it as an
+// Option does.
+func WithWorkerConfig(wc WorkerConfig) Option {
+	return wc
+}
+
+// WithCheckInterval sets the CheckInterval, which is 10 seconds by
+// default. A shorter one than MinCheckInterval is raised to it.
+func WithCheckInterval(d time.Duration) Option {
+	return optionFunc(func(ds *DynoScaler) {
+		ds.CheckInterval = d
+	})
+}
+
+// WithWorkerConfigs adds all of the worker configs, which is handy
+// when they are kept in a slice.
+func WithWorkerConfigs(workerConfigs ...WorkerConfig) Option {
+	return optionFunc(func(ds *DynoScaler) {
+		ds.workerConfigs = append(ds.workerConfigs, workerConfigs...)
+	})
+}
+
+// WithLogger makes the DynoScaler log to logger instead of a logger of
+// its own, e.g. to share the formatting and output of the application.
+func WithLogger(logger *logrus.Logger) Option {
+	return optionFunc(func(ds *DynoScaler) {
+		ds.Logger = logger
+		ds.log = logger.WithField("pkg", "dynoscaler")
+	})
+}
+
+// WithLogLevel sets the level of the logger, which is InfoLevel by
+// default. Used after WithLogger, it changes the level of that logger.
+func WithLogLevel(level logrus.Level) Option {
+	return optionFunc(func(ds *DynoScaler) {
+		ds.Logger.SetLevel(level)
+	})
+}
+
+// WithFormatter sets the formatter of the logger, e.g. a
+// logrus.JSONFormatter for a log pipeline expecting JSON. Used after
+// WithLogger, it changes the formatter of that logger.
+func WithFormatter(formatter logrus.Formatter) Option {
+	return optionFunc(func(ds *DynoScaler) {
+		ds.Logger.SetFormatter(formatter)
+	})
+}
@@ -0,0 +1,202 @@
+package dynoscaler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+	"github.com/sirupsen/logrus"
+)
+
+func TestNewDynoScalerDefaultLogLevel(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+
+	if level := ds.Logger.GetLevel(); level != logrus.InfoLevel {
+		t.Errorf("expected log level to be info, got %s", level)
+	}
+}
+
+func TestWithLogLevel(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "", WithLogLevel(logrus.DebugLevel))
+
+	if level := ds.Logger.GetLevel(); level != logrus.DebugLevel {
+		t.Errorf("expected log level to be debug, got %s", level)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+
+	ds := NewDynoScaler("", "", "", "", "", WithLogger(logger), WithLogLevel(logrus.WarnLevel))
+
+	if ds.Logger != logger {
+		t.Error("expected Logger to be the provided logger")
+	}
+
+	if ds.log.Logger != logger {
+		t.Error("expected the log entry to use the provided logger")
+	}
+
+	if level := logger.GetLevel(); level != logrus.WarnLevel {
+		t.Errorf("expected log level of the provided logger to be warn, got %s", level)
+	}
+
+	ds.log.Info("hidden")
+	ds.log.Warn("shown")
+
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, "shown") || !strings.Contains(out, "pkg=dynoscaler") {
+		t.Errorf("expected only the warning to be logged, got %q", out)
+	}
+}
+
+func TestNew(t *testing.T) {
+	foo := WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "foo", WorkerType: "fooworker"}
+	bar := WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "bar", WorkerType: "barworker"}
+
+	ds := New(
+		WithRabbitMQ("baboon.rmq.cloudamqp.com", "username", "password"),
+		WithHeroku("apikey", "app"),
+		WithWorkerConfig(foo),
+		WithWorkerConfig(bar),
+		WithCheckInterval(time.Minute),
+		WithLogLevel(logrus.WarnLevel),
+	)
+
+	if ds.rabbitMQHost != "baboon.rmq.cloudamqp.com" {
+		t.Errorf("expected rabbitMQHost to be baboon.rmq.cloudamqp.com, got %s", ds.rabbitMQHost)
+	}
+
+	if ds.rabbitMQUsername != "username" {
+		t.Errorf("expected rabbitMQUsername to be username, got %s", ds.rabbitMQUsername)
+	}
+
+	if ds.rabbitMQPassword != "password" {
+		t.Errorf("expected rabbitMQPassword to be password, got %s", ds.rabbitMQPassword)
+	}
+
+	if ds.herokuAPIKey != "apikey" {
+		t.Errorf("expected herokuAPIKey to be apikey, got %s", ds.herokuAPIKey)
+	}
+
+	if ds.herokuAppID != "app" {
+		t.Errorf("expected herokuAppID to be app, got %s", ds.herokuAppID)
+	}
+
+	if expected := []WorkerConfig{foo, bar}; !reflect.DeepEqual(ds.workerConfigs, expected) {
+		t.Errorf("expected worker configs to be %+v, got %+v", expected, ds.workerConfigs)
+	}
+
+	if ds.CheckInterval != time.Minute {
+		t.Errorf("expected CheckInterval to be 1m0s, got %s", ds.CheckInterval)
+	}
+
+	if level := ds.Logger.GetLevel(); level != logrus.WarnLevel {
+		t.Errorf("expected log level to be warn, got %s", level)
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	ds := New()
+
+	if ds.CheckInterval != 10*time.Second {
+		t.Errorf("expected CheckInterval to be 10s, got %s", ds.CheckInterval)
+	}
+
+	if ds.WorkerCeiling != 1000 {
+		t.Errorf("expected WorkerCeiling to be 1000, got %d", ds.WorkerCeiling)
+	}
+
+	if ds.state == nil || ds.log == nil {
+		t.Error("expected the internal state to be initialized")
+	}
+}
+
+func TestWithWorkerConfigs(t *testing.T) {
+	foo := WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "foo", WorkerType: "fooworker"}
+	bar := WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "bar", WorkerType: "barworker"}
+	baz := WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "baz", WorkerType: "bazworker"}
+
+	ds := NewDynoScaler("", "", "", "", "", foo, WithWorkerConfigs(bar, baz))
+
+	if expected := []WorkerConfig{foo, bar, baz}; !reflect.DeepEqual(ds.workerConfigs, expected) {
+		t.Errorf("expected worker configs to be %+v, got %+v", expected, ds.workerConfigs)
+	}
+}
+
+func TestWithFormatter(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	ds := NewDynoScaler("", "", "", "", "app",
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			QueueName:       "foo",
+			WorkerType:      "bar",
+		},
+		WithLogger(logger),
+		WithFormatter(&logrus.JSONFormatter{}),
+	)
+	ds.hs = hs
+	ds.rmqc = rmqc
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	var scaling map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("expected log line to be valid JSON, got %q", line)
+		}
+
+		if entry["msg"] == "scaling dynos" {
+			scaling = entry
+		}
+	}
+
+	if scaling == nil {
+		t.Fatal("expected the scaling to be logged")
+	}
+
+	if scaling["worker_type"] != "bar" || scaling["new_quantity"] != float64(2) || scaling["pkg"] != "dynoscaler" {
+		t.Errorf("expected the fields of the scaling to be logged, got %v", scaling)
+	}
+}
+
+func TestWithCheckIntervalMinimum(t *testing.T) {
+	for _, d := range []time.Duration{0, 5 * time.Millisecond} {
+		var buf bytes.Buffer
+		logger := logrus.New()
+		logger.SetOutput(&buf)
+
+		ds := New(WithLogger(logger), WithCheckInterval(d))
+
+		if ds.CheckInterval != MinCheckInterval {
+			t.Errorf("expected CheckInterval %s to be raised to %s, got %s", d, MinCheckInterval, ds.CheckInterval)
+		}
+
+		if !strings.Contains(buf.String(), "raising CheckInterval") {
+			t.Errorf("expected a warning about raising CheckInterval %s, got %q", d, buf.String())
+		}
+	}
+
+	ds := New(WithCheckInterval(-time.Second))
+	if ds.CheckInterval != -time.Second {
+		t.Errorf("expected a negative CheckInterval to be left to ValidateConfig, got %s", ds.CheckInterval)
+	}
+}
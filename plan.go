@@ -0,0 +1,107 @@
+package dynoscaler
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ScalePlan is what a check would do with a worker config, as
+// returned by Plan.
+type ScalePlan struct {
+	HerokuApp       string
+	WorkerType      string
+	QueueName       string
+	TotalMessages   int
+	CurrentQuantity int
+	DesiredQuantity int
+	Decision        Decision
+
+	// Whether a check would update the Heroku formation, unless it
+	// is paused, DryRun is set, BeforeScale aborts it or
+	// AllowScaleDown vetoes it.
+	WouldScale bool
+}
+
+// Plan evaluates all of the worker configs just like CheckOnce,
+// including the cooldowns and MaxTotalWorkers, but never scales any
+// of them. Unlike DryRun, it doesn't record anything either, so the
+// cooldowns, Snapshot, the metrics and the events are left untouched,
+// and the holds are only logged at Debug. It doesn't call
+// AllowScaleDown, and doesn't start the PostDeployGrace either, which
+// is held as if the scaler were started by the plan.
+// The Disabled worker configs and the worker types which aren't in the
+// Heroku formation are left out of the plans. If some of the worker
+// configs can't be evaluated, the plans of the others are returned
+// together with the combined error.
+func (ds *DynoScaler) Plan(ctx context.Context) ([]ScalePlan, error) {
+	if err := ds.initClients(); err != nil {
+		return nil, err
+	}
+
+	ds.loadState()
+
+	ds.state.configs.RLock()
+	defer ds.state.configs.RUnlock()
+
+	configs := make([]int, len(ds.workerConfigs))
+	for i := range configs {
+		configs[i] = i
+	}
+	configs = ds.enabled(configs)
+
+	queues, err := ds.lookupQueues(ctx, configs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list queues")
+	}
+
+	if wait := ds.rateLimitWait(); wait > 0 {
+		return nil, errors.Errorf("holding off Heroku calls for %s due to rate limiting", wait)
+	}
+
+	evs, checked, results := ds.evaluateConfigs(ctx, ds.newScalers(configs), configs, queues, true)
+
+	var plans []ScalePlan
+	var errs multiError
+
+	for j, i := range configs {
+		if results[j] != nil {
+			errs = append(errs, results[j])
+		}
+
+		if !checked[j] {
+			continue
+		}
+
+		wc := ds.workerConfigs[i]
+
+		ds.state.mu.Lock()
+		ev := ds.cooldown(wc, evs[j])
+		ds.state.mu.Unlock()
+
+		plans = append(plans, ScalePlan{
+			HerokuApp:       ds.appOf(wc),
+			WorkerType:      wc.WorkerType,
+			QueueName:       ev.queueName,
+			TotalMessages:   ev.totalMsgs,
+			CurrentQuantity: ev.oldQuantity,
+			DesiredQuantity: ev.newQuantity,
+			Decision:        ev.decision,
+			WouldScale:      ev.decision.scales(),
+		})
+	}
+
+	return plans, errs.errOrNil()
+}
+
+// logHold logs that a scaling is held or reduced with entry, at Info
+// during the checks, but only at Debug while planning.
+func logHold(entry *logrus.Entry, planning bool, msg string) {
+	if planning {
+		entry.Debug(msg)
+		return
+	}
+
+	entry.Info(msg)
+}
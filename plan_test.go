@@ -0,0 +1,217 @@
+package dynoscaler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+func TestPlan(t *testing.T) {
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{
+			{Type: "fooworker", Quantity: 0},
+			{Type: "barworker", Quantity: 2},
+			{Type: "bazworker", Quantity: 1},
+		},
+	}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{
+			{Name: "foo", Messages: 10},
+			{Name: "bar", Messages: 0},
+			{Name: "baz", Messages: 1},
+		},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "baz",
+			WorkerType:      "bazworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "baz",
+			WorkerType:      "undeployed",
+		},
+	)
+	ds.Events = make(chan ScalingEvent, 4)
+
+	plans, err := ds.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []ScalePlan{
+		{
+			HerokuApp:       "app",
+			WorkerType:      "fooworker",
+			QueueName:       "foo",
+			TotalMessages:   10,
+			CurrentQuantity: 0,
+			DesiredQuantity: 2,
+			Decision:        ScaleUp,
+			WouldScale:      true,
+		},
+		{
+			HerokuApp:       "app",
+			WorkerType:      "barworker",
+			QueueName:       "bar",
+			TotalMessages:   0,
+			CurrentQuantity: 2,
+			DesiredQuantity: 0,
+			Decision:        ScaleDown,
+			WouldScale:      true,
+		},
+		{
+			HerokuApp:       "app",
+			WorkerType:      "bazworker",
+			QueueName:       "baz",
+			TotalMessages:   1,
+			CurrentQuantity: 1,
+			DesiredQuantity: 1,
+			Decision:        NoChange,
+		},
+	}
+	if !reflect.DeepEqual(plans, expected) {
+		t.Errorf("expected plans to be %+v, got %+v", expected, plans)
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 0 {
+		t.Errorf("expected no formation updates, got %+v", updates)
+	}
+
+	if len(ds.Events) != 0 {
+		t.Errorf("expected no events, got %d", len(ds.Events))
+	}
+
+	if status := ds.Snapshot()[0]; !status.LastChecked.IsZero() {
+		t.Errorf("expected the status to be left untouched, got %+v", status)
+	}
+}
+
+func TestPlanLeavesCooldownsUntouched(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.ScaleUpCooldown = time.Minute
+
+	for i := 0; i < 2; i++ {
+		plans, err := ds.Plan(context.Background())
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if plans[0].Decision != ScaleUp {
+			t.Errorf("expected plan %d to scale up, got %s", i, plans[0].Decision)
+		}
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "bar", quantity: 1}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+
+	hs.mu.Lock()
+	hs.formations[0].Quantity = 0
+	hs.mu.Unlock()
+
+	plans, err := ds.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if plans[0].Decision != CooldownSuppressed || plans[0].WouldScale {
+		t.Errorf("expected the plan to be suppressed by the cooldown, got %+v", plans[0])
+	}
+}
+
+func TestPlanLeavesGraceUntouched(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.PostDeployGrace = time.Minute
+
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	ds.now = func() time.Time { return now }
+
+	plans, err := ds.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if plans[0].Decision != Hold {
+		t.Errorf("expected the plan to be held within the grace, got %s", plans[0].Decision)
+	}
+
+	// the grace starts with the monitoring, not with the plan
+	now = now.Add(2 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := ds.MonitorContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected error to be context.DeadlineExceeded, got %v", err)
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 0 {
+		t.Errorf("expected no scaling within the grace, got %+v", updates)
+	}
+}
+
+func TestPlanDoesNotCallAllowScaleDown(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 2}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 0}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	calls := 0
+	ds.AllowScaleDown = func(wc WorkerConfig) bool {
+		calls++
+		return false
+	}
+
+	plans, err := ds.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if calls != 0 {
+		t.Errorf("expected AllowScaleDown not to be called, got %d calls", calls)
+	}
+
+	if plans[0].Decision != ScaleDown {
+		t.Errorf("expected the plan to scale down, got %s", plans[0].Decision)
+	}
+}
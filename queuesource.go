@@ -0,0 +1,138 @@
+package dynoscaler
+
+import (
+	"net/http"
+	"sort"
+
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// QueueSource lists the queues of the RabbitMQ broker, together with
+// their message counts. The default is the RabbitMQ Management API.
+type QueueSource interface {
+	ListQueues() ([]rabbithole.QueueInfo, error)
+}
+
+// PrometheusQueueSource is a QueueSource which scrapes the queue
+// metrics of the RabbitMQ Prometheus plugin or rabbitmq_exporter,
+// e.g. rabbitmq_queue_messages_ready{queue="foo",vhost="/"}. As the
+// metrics don't include the publish rates, it can't be used with
+// RatioByPublishRate.
+type PrometheusQueueSource struct {
+	// URL of the metrics endpoint, e.g. "http://localhost:15692/metrics".
+	URL string
+
+	// Used for the requests to the metrics endpoint.
+	// Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// NewPrometheusQueueSource returns a PrometheusQueueSource for
+// the metrics endpoint at url.
+func NewPrometheusQueueSource(url string) *PrometheusQueueSource {
+	return &PrometheusQueueSource{URL: url}
+}
+
+// ListQueues scrapes the metrics endpoint and returns the queues found
+// in the metrics. Messages is set to the number of ready messages, or
+// if the endpoint doesn't report them, to the total number of messages
+// minus the unacknowledged ones.
+func (s *PrometheusQueueSource) ListQueues() ([]rabbithole.QueueInfo, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(s.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scrape queue metrics")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to scrape queue metrics: %s", resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse queue metrics")
+	}
+
+	type queueKey struct{ vhost, name string }
+	queues := make(map[queueKey]*rabbithole.QueueInfo)
+	total := make(map[queueKey]int)
+	ready := make(map[queueKey]bool)
+
+	for name, family := range families {
+		for _, m := range family.GetMetric() {
+			var key queueKey
+			for _, label := range m.GetLabel() {
+				switch label.GetName() {
+				case "queue":
+					key.name = label.GetValue()
+				case "vhost":
+					key.vhost = label.GetValue()
+				}
+			}
+
+			if key.name == "" {
+				continue
+			}
+
+			q, ok := queues[key]
+			if !ok {
+				q = &rabbithole.QueueInfo{Name: key.name, Vhost: key.vhost}
+				queues[key] = q
+			}
+
+			n := int(metricValue(m))
+
+			switch name {
+			case "rabbitmq_queue_messages":
+				total[key] = n
+			case "rabbitmq_queue_messages_ready":
+				q.Messages = n
+				ready[key] = true
+			case "rabbitmq_queue_messages_unacked", "rabbitmq_queue_messages_unacknowledged":
+				q.MessagesUnacknowledged = n
+			case "rabbitmq_queue_consumers":
+				q.Consumers = n
+			}
+		}
+	}
+
+	result := make([]rabbithole.QueueInfo, 0, len(queues))
+	for key, q := range queues {
+		if !ready[key] {
+			q.Messages = total[key] - q.MessagesUnacknowledged
+		}
+
+		result = append(result, *q)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Vhost != result[j].Vhost {
+			return result[i].Vhost < result[j].Vhost
+		}
+
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// metricValue returns the value of m, whatever its type.
+func metricValue(m *dto.Metric) float64 {
+	switch {
+	case m.Gauge != nil:
+		return m.GetGauge().GetValue()
+	case m.Counter != nil:
+		return m.GetCounter().GetValue()
+	default:
+		return m.GetUntyped().GetValue()
+	}
+}
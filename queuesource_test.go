@@ -0,0 +1,122 @@
+package dynoscaler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+const sampleQueueMetrics = `# HELP rabbitmq_queue_messages_ready Messages ready to be delivered to consumers
+# TYPE rabbitmq_queue_messages_ready gauge
+rabbitmq_queue_messages_ready{vhost="/",queue="foo"} 7
+rabbitmq_queue_messages_ready{vhost="/",queue="bar"} 0
+rabbitmq_queue_messages_ready{vhost="other",queue="foo"} 2
+# HELP rabbitmq_queue_messages_unacked Messages delivered to consumers but not yet acknowledged
+# TYPE rabbitmq_queue_messages_unacked gauge
+rabbitmq_queue_messages_unacked{vhost="/",queue="foo"} 3
+rabbitmq_queue_messages_unacked{vhost="/",queue="bar"} 0
+rabbitmq_queue_messages_unacked{vhost="other",queue="foo"} 0
+# HELP rabbitmq_queue_consumers Consumers on a queue
+# TYPE rabbitmq_queue_consumers gauge
+rabbitmq_queue_consumers{vhost="/",queue="foo"} 2
+rabbitmq_queue_consumers{vhost="/",queue="bar"} 1
+rabbitmq_queue_consumers{vhost="other",queue="foo"} 0
+# HELP rabbitmq_connections Connections currently open
+# TYPE rabbitmq_connections gauge
+rabbitmq_connections 4
+`
+
+func newMetricsServer(metrics string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, metrics)
+	}))
+}
+
+func TestPrometheusQueueSource(t *testing.T) {
+	server := newMetricsServer(sampleQueueMetrics)
+	defer server.Close()
+
+	queues, err := NewPrometheusQueueSource(server.URL).ListQueues()
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []rabbithole.QueueInfo{
+		{Name: "bar", Vhost: "/", Messages: 0, MessagesUnacknowledged: 0, Consumers: 1},
+		{Name: "foo", Vhost: "/", Messages: 7, MessagesUnacknowledged: 3, Consumers: 2},
+		{Name: "foo", Vhost: "other", Messages: 2, MessagesUnacknowledged: 0, Consumers: 0},
+	}
+	if !reflect.DeepEqual(queues, expected) {
+		t.Errorf("expected queues to be %+v, got %+v", expected, queues)
+	}
+}
+
+func TestPrometheusQueueSourceTotalMessages(t *testing.T) {
+	server := newMetricsServer(`# TYPE rabbitmq_queue_messages gauge
+rabbitmq_queue_messages{vhost="/",queue="foo"} 12
+# TYPE rabbitmq_queue_messages_unacknowledged gauge
+rabbitmq_queue_messages_unacknowledged{vhost="/",queue="foo"} 5
+`)
+	defer server.Close()
+
+	queues, err := NewPrometheusQueueSource(server.URL).ListQueues()
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if len(queues) != 1 {
+		t.Fatalf("expected 1 queue, got %d", len(queues))
+	}
+
+	if queues[0].Messages != 7 || queues[0].MessagesUnacknowledged != 5 {
+		t.Errorf("expected 7 ready and 5 unacked messages, got %d and %d", queues[0].Messages, queues[0].MessagesUnacknowledged)
+	}
+}
+
+func TestPrometheusQueueSourceError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := NewPrometheusQueueSource(server.URL).ListQueues()
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if err.Error() != "failed to scrape queue metrics: 503 Service Unavailable" {
+		t.Errorf("expected error about the status, got %s", err.Error())
+	}
+}
+
+func TestCheckOnceQueueSource(t *testing.T) {
+	server := newMetricsServer(sampleQueueMetrics)
+	defer server.Close()
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "fooworker", Quantity: 0}}}
+	rmqc := &fakeRabbit{err: fmt.Errorf("the management API should not be used")}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+		QueueName:       "foo",
+		WorkerType:      "fooworker",
+	})
+	ds.QueueSource = NewPrometheusQueueSource(server.URL)
+	ds.Vhost = "/"
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []formationUpdate{{app: "app", workerType: "fooworker", quantity: 2}}
+	if updates := hs.updateCalls(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected formation updates to be %+v, got %+v", expected, updates)
+	}
+}
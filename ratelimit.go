@@ -0,0 +1,120 @@
+package dynoscaler
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// rateLimitPause is how long to hold off calling the Heroku Platform
+// API after hitting its rate limit. Heroku replenishes the limit at
+// roughly 75 requests per minute.
+const rateLimitPause = time.Minute
+
+// minRateLimitRemaining is the number of requests left in the rate
+// limit of the Heroku Platform API below which the scaler holds off
+// calling it, before it gets rejected, e.g. when several scalers share
+// the account. The limit allows 4500 requests per hour.
+const minRateLimitRemaining = 100
+
+// rateLimitTransport passes the RateLimit-Remaining header of the
+// responses of the Heroku Platform API to observe.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	observe func(remaining int)
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if remaining, err := strconv.Atoi(resp.Header.Get("RateLimit-Remaining")); err == nil {
+		t.observe(remaining)
+	}
+
+	return resp, nil
+}
+
+// isRateLimited reports whether err was caused by exceeding
+// the rate limit of the Heroku Platform API.
+func isRateLimited(err error) bool {
+	err = errors.Cause(err)
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+
+	herr, ok := err.(heroku.Error)
+	return ok && herr.StatusCode == http.StatusTooManyRequests
+}
+
+// observeHerokuError starts holding off the Heroku calls if err
+// was caused by exceeding the rate limit.
+func (ds *DynoScaler) observeHerokuError(err error) {
+	if !isRateLimited(err) {
+		return
+	}
+
+	until := ds.holdOffHeroku()
+
+	ds.log.WithFields(logrus.Fields{
+		"heroku_app": ds.herokuAppID,
+		"until":      until,
+	}).Warn("hit Heroku API rate limit, holding off Heroku calls")
+}
+
+// observeRateLimitRemaining starts holding off the Heroku calls if
+// fewer than minRateLimitRemaining requests are left in the rate limit.
+func (ds *DynoScaler) observeRateLimitRemaining(remaining int) {
+	if remaining >= minRateLimitRemaining {
+		return
+	}
+
+	until := ds.holdOffHeroku()
+
+	ds.log.WithFields(logrus.Fields{
+		"heroku_app": ds.herokuAppID,
+		"remaining":  remaining,
+		"until":      until,
+	}).Warn("Heroku API rate limit almost reached, holding off Heroku calls")
+}
+
+// holdOffHeroku holds off the Heroku calls for the rateLimitPause,
+// and returns until when.
+func (ds *DynoScaler) holdOffHeroku() time.Time {
+	until := ds.now().Add(rateLimitPause)
+
+	ds.state.mu.Lock()
+	ds.state.rateLimitedUntil = until
+	ds.state.mu.Unlock()
+
+	return until
+}
+
+// rateLimitWait returns how much longer the Heroku calls should be
+// held off because of the rate limit, or zero if they are allowed.
+func (ds *DynoScaler) rateLimitWait() time.Duration {
+	wait := ds.RateLimitedUntil().Sub(ds.now())
+	if wait < 0 {
+		return 0
+	}
+
+	return wait
+}
+
+// RateLimitedUntil returns the time until which the scaler holds off
+// calling the Heroku Platform API after it has hit the rate limit, or
+// has almost reached it according to the RateLimit-Remaining header.
+// The time is in the past if the Heroku calls are currently allowed.
+func (ds *DynoScaler) RateLimitedUntil() time.Time {
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	return ds.state.rateLimitedUntil
+}
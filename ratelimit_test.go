@@ -0,0 +1,155 @@
+package dynoscaler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+// newRateLimitedHeroku returns a Heroku service for a server that
+// responds to every request with a rate limit error, and a function
+// returning the number of requests made.
+func newRateLimitedHeroku(t *testing.T) (*heroku.Service, func() int) {
+	var mu sync.Mutex
+	requests := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"id": "rate_limit", "message": "Your account reached the API rate limit"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	hs := heroku.NewService(&http.Client{Transport: &heroku.Transport{}})
+	hs.URL = srv.URL
+
+	return hs, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return requests
+	}
+}
+
+func TestCheckOnceHoldsOffAfterRateLimit(t *testing.T) {
+	hs, requests := newRateLimitedHeroku(t)
+
+	ds := NewDynoScaler("", "", "", "", "app", WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.hs = hs
+	ds.rmqc = &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+	ds.randInt63n = func(n int64) int64 { return 0 }
+
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	ds.now = func() time.Time { return now }
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if n := requests(); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+
+	if until := ds.RateLimitedUntil(); !until.Equal(now.Add(rateLimitPause)) {
+		t.Errorf("expected to be rate limited until %s, got %s", now.Add(rateLimitPause), until)
+	}
+
+	if d := ds.nextInterval(ds.CheckInterval); d != rateLimitPause {
+		t.Errorf("expected next interval to be %s, got %s", rateLimitPause, d)
+	}
+
+	now = now.Add(ds.CheckInterval)
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if n := requests(); n != 1 {
+		t.Errorf("expected no requests while rate limited, got %d", n-1)
+	}
+
+	now = now.Add(rateLimitPause)
+
+	ds.CheckOnce(context.Background())
+
+	if n := requests(); n != 2 {
+		t.Errorf("expected requests to resume after the rate limit pause, got %d", n-1)
+	}
+}
+
+func TestScaleDoesNotRetryWhenRateLimited(t *testing.T) {
+	hs, requests := newRateLimitedHeroku(t)
+
+	ds := NewDynoScaler("", "", "", "", "app")
+	ds.hs = hs
+	ds.ScaleRetries = 3
+	ds.retryDelay = time.Millisecond
+
+	if err := ds.scale(context.Background(), ds.newScaler("app"), "app", "bar", 1); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if n := requests(); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+func TestCheckOnceHoldsOffWhenRateLimitLow(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+
+		w.Header().Set("RateLimit-Remaining", "10")
+		w.Write([]byte(`[{"type": "bar", "quantity": 1}]`))
+	}))
+	defer srv.Close()
+
+	ds := NewDynoScaler("", "", "", "", "app", WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.HerokuURL = srv.URL
+	ds.rmqc = &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	ds.now = func() time.Time { return now }
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if until := ds.RateLimitedUntil(); !until.Equal(now.Add(rateLimitPause)) {
+		t.Errorf("expected to be rate limited until %s, got %s", now.Add(rateLimitPause), until)
+	}
+
+	now = now.Add(ds.CheckInterval)
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected the check to hold off the Heroku calls")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if requests != 1 {
+		t.Errorf("expected no requests while the rate limit is low, got %d", requests-1)
+	}
+}
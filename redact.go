@@ -0,0 +1,58 @@
+package dynoscaler
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// redacted replaces the secrets in the String and MarshalJSON output.
+const redacted = "****"
+
+// redact returns redacted in place of secret, unless it is empty.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return redacted
+}
+
+// String describes the DynoScaler for logging, with the RabbitMQ
+// password and the Heroku API key redacted.
+func (ds DynoScaler) String() string {
+	return fmt.Sprintf(
+		"DynoScaler{RabbitMQ: %s, RabbitMQUsername: %s, RabbitMQPassword: %s, HerokuApp: %s, HerokuAPIKey: %s, WorkerConfigs: %d}",
+		ds.rabbitMQURL(),
+		ds.rabbitMQUsername,
+		redact(ds.rabbitMQPassword),
+		ds.herokuAppID,
+		redact(ds.herokuAPIKey),
+		len(ds.workerConfigs),
+	)
+}
+
+// GoString keeps %#v from printing the secrets, see String.
+func (ds DynoScaler) GoString() string {
+	return ds.String()
+}
+
+// MarshalJSON encodes the connection settings and the worker configs
+// of the DynoScaler, with the RabbitMQ password and the Heroku API key
+// redacted.
+func (ds DynoScaler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		RabbitMQ         string         `json:"rabbitmq"`
+		RabbitMQUsername string         `json:"rabbitmq_username"`
+		RabbitMQPassword string         `json:"rabbitmq_password"`
+		HerokuApp        string         `json:"heroku_app"`
+		HerokuAPIKey     string         `json:"heroku_api_key"`
+		WorkerConfigs    []WorkerConfig `json:"worker_configs"`
+	}{
+		RabbitMQ:         ds.rabbitMQURL(),
+		RabbitMQUsername: ds.rabbitMQUsername,
+		RabbitMQPassword: redact(ds.rabbitMQPassword),
+		HerokuApp:        ds.herokuAppID,
+		HerokuAPIKey:     redact(ds.herokuAPIKey),
+		WorkerConfigs:    ds.workerConfigs,
+	})
+}
@@ -0,0 +1,53 @@
+package dynoscaler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDynoScalerRedactsSecrets(t *testing.T) {
+	ds := NewDynoScaler("baboon.rmq.cloudamqp.com", "username", "s3cr3t-password", "s3cr3t-apikey", "app", WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	data, err := json.Marshal(ds)
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	outputs := map[string]string{
+		"String":      ds.String(),
+		"%v":          fmt.Sprintf("%v", ds),
+		"%+v":         fmt.Sprintf("%+v", ds),
+		"%#v":         fmt.Sprintf("%#v", ds),
+		"%v pointer":  fmt.Sprintf("%v", &ds),
+		"MarshalJSON": string(data),
+	}
+
+	for name, out := range outputs {
+		for _, secret := range []string{"s3cr3t-password", "s3cr3t-apikey"} {
+			if strings.Contains(out, secret) {
+				t.Errorf("expected %s output to not contain %s, got %s", name, secret, out)
+			}
+		}
+
+		for _, expected := range []string{"baboon.rmq.cloudamqp.com", "app", redacted} {
+			if !strings.Contains(out, expected) {
+				t.Errorf("expected %s output to contain %s, got %s", name, expected, out)
+			}
+		}
+	}
+}
+
+func TestDynoScalerStringWithoutSecrets(t *testing.T) {
+	ds := NewDynoScaler("http://localhost:15672", "guest", "", "", "app")
+
+	expected := "DynoScaler{RabbitMQ: http://localhost:15672, RabbitMQUsername: guest, RabbitMQPassword: , HerokuApp: app, HerokuAPIKey: , WorkerConfigs: 0}"
+	if s := ds.String(); s != expected {
+		t.Errorf("expected String to be %q, got %q", expected, s)
+	}
+}
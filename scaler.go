@@ -0,0 +1,99 @@
+package dynoscaler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	"github.com/pkg/errors"
+)
+
+// Scaler is the platform the workers run on, which is the Heroku
+// formation of the app by default. Implementing it allows the queue
+// based scaling to be reused with a different platform.
+type Scaler interface {
+	// CurrentQuantity returns the number of workers of workerType,
+	// or an error matching ErrFormationNotFound if there is no such
+	// worker type, in which case its worker config is skipped.
+	CurrentQuantity(ctx context.Context, workerType string) (int, error)
+
+	// SetQuantity scales the workers of workerType to n.
+	SetQuantity(ctx context.Context, workerType string, n int) error
+}
+
+// herokuScaler is the Scaler of a Heroku app. The formations and
+// dynos are listed only once and then reused, so a new one is used
+// per check. The formations are listed again once they are older
+// than maxAge, if set.
+type herokuScaler struct {
+	hs     herokuClient
+	app    string
+	now    func() time.Time
+	maxAge time.Duration
+
+	// guards the listing, since worker configs may be checked concurrently
+	mu sync.Mutex
+
+	listed     bool
+	listedAt   time.Time
+	formations []heroku.Formation
+	err        error
+
+	dynosListed bool
+	dynos       []heroku.Dyno
+	dynosErr    error
+}
+
+func (s *herokuScaler) CurrentQuantity(ctx context.Context, workerType string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listed && s.maxAge > 0 && s.now().Sub(s.listedAt) > s.maxAge {
+		s.listed = false
+	}
+
+	if !s.listed {
+		s.formations, s.err = s.hs.FormationList(ctx, s.app, nil)
+		s.listed = true
+
+		if s.maxAge > 0 {
+			s.listedAt = s.now()
+		}
+
+		if s.err != nil {
+			s.err = errors.Wrap(s.err, "failed to list formations")
+		}
+	}
+
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	return formationQuantity(s.formations, workerType)
+}
+
+func (s *herokuScaler) SetQuantity(ctx context.Context, workerType string, n int) error {
+	return scaleDynos(ctx, s.hs, s.app, workerType, n)
+}
+
+// formationQuantity returns the quantity of the workerType formation.
+func formationQuantity(formations []heroku.Formation, workerType string) (int, error) {
+	for i := range formations {
+		if formations[i].Type == workerType {
+			return formations[i].Quantity, nil
+		}
+	}
+
+	return 0, &FormationNotFoundError{WorkerType: workerType}
+}
+
+// newScaler returns the Scaler to use for the worker configs of app.
+func (ds *DynoScaler) newScaler(app string) Scaler {
+	if ds.Scaler != nil {
+		return ds.Scaler
+	}
+
+	hs := timedHeroku{herokuClient: ds.hs, observe: ds.observeCall}
+	return &herokuScaler{hs: hs, app: app, now: ds.now, maxAge: ds.FormationMaxAge}
+}
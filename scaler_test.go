@@ -0,0 +1,231 @@
+package dynoscaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+// fakeScaler is a Scaler which keeps the quantities in memory.
+type fakeScaler struct {
+	quantities map[string]int
+	sets       []string
+}
+
+func (fs *fakeScaler) CurrentQuantity(ctx context.Context, workerType string) (int, error) {
+	n, ok := fs.quantities[workerType]
+	if !ok {
+		return 0, errors.New("unknown worker type")
+	}
+
+	return n, nil
+}
+
+func (fs *fakeScaler) SetQuantity(ctx context.Context, workerType string, n int) error {
+	fs.quantities[workerType] = n
+	fs.sets = append(fs.sets, workerType)
+
+	return nil
+}
+
+func TestCheckOnceScaler(t *testing.T) {
+	hs := &fakeHeroku{}
+	sc := &fakeScaler{quantities: map[string]int{"fooworker": 0, "barworker": 3}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{
+		{Name: "foo", Messages: 10},
+		{Name: "bar", Messages: 0},
+	}}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+	ds.Scaler = sc
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := map[string]int{"fooworker": 2, "barworker": 0}
+	if !reflect.DeepEqual(sc.quantities, expected) {
+		t.Errorf("expected quantities to be %v, got %v", expected, sc.quantities)
+	}
+
+	if len(hs.formationLists) != 0 || len(hs.updateCalls()) != 0 {
+		t.Error("expected Heroku to not be used")
+	}
+}
+
+func TestHerokuScalerListsOnce(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{
+		{Type: "fooworker", Quantity: 1},
+		{Type: "barworker", Quantity: 2},
+	}}
+	sc := &herokuScaler{hs: hs, app: "app"}
+
+	for workerType, expected := range map[string]int{"fooworker": 1, "barworker": 2} {
+		n, err := sc.CurrentQuantity(context.Background(), workerType)
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if n != expected {
+			t.Errorf("expected quantity of %s to be %d, got %d", workerType, expected, n)
+		}
+	}
+
+	if _, err := sc.CurrentQuantity(context.Background(), "bazworker"); !errors.Is(err, ErrFormationNotFound) {
+		t.Errorf("expected ErrFormationNotFound, got %v", err)
+	}
+
+	if len(hs.formationLists) != 1 {
+		t.Errorf("expected formations to be listed once, got %d", len(hs.formationLists))
+	}
+}
+
+func TestHerokuScalerFormationMaxAge(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "fooworker", Quantity: 1}}}
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sc := &herokuScaler{
+		hs:     hs,
+		app:    "app",
+		now:    func() time.Time { return now },
+		maxAge: time.Minute,
+	}
+
+	quantity := func() int {
+		n, err := sc.CurrentQuantity(context.Background(), "fooworker")
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		return n
+	}
+
+	quantity()
+	now = now.Add(time.Minute)
+	quantity()
+
+	if len(hs.formationLists) != 1 {
+		t.Errorf("expected formations within FormationMaxAge to be reused, got %d listings", len(hs.formationLists))
+	}
+
+	hs.formations = []heroku.Formation{{Type: "fooworker", Quantity: 4}}
+	now = now.Add(time.Second)
+
+	if n := quantity(); n != 4 {
+		t.Errorf("expected the stale formations to be listed again, got quantity %d", n)
+	}
+
+	if len(hs.formationLists) != 2 {
+		t.Errorf("expected formations to be listed twice, got %d", len(hs.formationLists))
+	}
+}
+
+func TestHerokuScalerListError(t *testing.T) {
+	hs := &fakeHeroku{formationListErr: errors.New("unavailable")}
+	sc := &herokuScaler{hs: hs, app: "app"}
+
+	for i := 0; i < 2; i++ {
+		_, err := sc.CurrentQuantity(context.Background(), "fooworker")
+		if err == nil {
+			t.Fatal("expected error to not be nil")
+		}
+
+		if err.Error() != "failed to list formations: unavailable" {
+			t.Errorf("expected list error, got %s", err.Error())
+		}
+	}
+
+	if len(hs.formationLists) != 1 {
+		t.Errorf("expected formations to be listed once, got %d", len(hs.formationLists))
+	}
+}
+
+// concurrentScaler is a Scaler which records how many of its
+// calls are running at the same time.
+type concurrentScaler struct {
+	mu      sync.Mutex
+	running int
+	max     int
+	checked map[string]bool
+}
+
+func (cs *concurrentScaler) CurrentQuantity(ctx context.Context, workerType string) (int, error) {
+	cs.mu.Lock()
+	cs.running++
+	if cs.running > cs.max {
+		cs.max = cs.running
+	}
+	cs.checked[workerType] = true
+	cs.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	cs.mu.Lock()
+	cs.running--
+	cs.mu.Unlock()
+
+	return 0, nil
+}
+
+func (cs *concurrentScaler) SetQuantity(ctx context.Context, workerType string, n int) error {
+	return nil
+}
+
+func TestCheckOnceConcurrency(t *testing.T) {
+	sc := &concurrentScaler{checked: make(map[string]bool)}
+	rmqc := &fakeRabbit{}
+
+	var wcs []WorkerConfig
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("worker%d", i)
+		rmqc.queues = append(rmqc.queues, rabbithole.QueueInfo{Name: name, Messages: 1})
+		wcs = append(wcs, WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       name,
+			WorkerType:      name,
+		})
+	}
+
+	ds := newTestDynoScaler(&fakeHeroku{}, rmqc, wcs...)
+	ds.Scaler = sc
+	ds.Concurrency = 4
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if len(sc.checked) != 8 {
+		t.Errorf("expected all 8 worker configs to be checked, got %d", len(sc.checked))
+	}
+
+	if sc.max < 2 || sc.max > 4 {
+		t.Errorf("expected 2 to 4 concurrent checks, got %d", sc.max)
+	}
+}
+
+func TestParallelSequential(t *testing.T) {
+	var order []int
+	parallel(5, 0, func(i int) { order = append(order, i) })
+
+	if expected := []int{0, 1, 2, 3, 4}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected calls to be in order %v, got %v", expected, order)
+	}
+}
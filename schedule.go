@@ -0,0 +1,110 @@
+package dynoscaler
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// clockLayout is the layout of the Start and End of a MinWorkersWindow.
+const clockLayout = "15:04"
+
+// MinWorkersWindow is a time of day during which a worker config keeps
+// a different number of workers running than its MinWorkers, e.g. a
+// higher floor overnight to absorb the morning spike.
+type MinWorkersWindow struct {
+	// Start and End of the window, written like "22:00" in the
+	// ScheduleTimezone of the worker config. The window includes Start
+	// but not End, and wraps around midnight when End is before Start,
+	// e.g. from "22:00" to "06:00". A window from a time to the same
+	// time lasts all day.
+	Start string `yaml:"start" json:"start"`
+	End   string `yaml:"end" json:"end"`
+
+	// Minimum number of workers to keep running during the window,
+	// used instead of the MinWorkers of the worker config.
+	MinWorkers int `yaml:"min_workers" json:"min_workers"`
+}
+
+// contains reports whether the time of day of t falls into w.
+func (w MinWorkersWindow) contains(t time.Time) (bool, error) {
+	start, err := minuteOfDay(w.Start)
+	if err != nil {
+		return false, err
+	}
+
+	end, err := minuteOfDay(w.End)
+	if err != nil {
+		return false, err
+	}
+
+	now := t.Hour()*60 + t.Minute()
+
+	if start <= end {
+		return start == end || start <= now && now < end, nil
+	}
+
+	return now >= start || now < end, nil
+}
+
+// validate checks that the Start and End of w are valid times of day.
+func (w MinWorkersWindow) validate() error {
+	if _, err := minuteOfDay(w.Start); err != nil {
+		return errors.Wrap(err, "invalid Start")
+	}
+
+	if _, err := minuteOfDay(w.End); err != nil {
+		return errors.Wrap(err, "invalid End")
+	}
+
+	return nil
+}
+
+// minuteOfDay parses clock, e.g. "22:00", into the minutes since midnight.
+func minuteOfDay(clock string) (int, error) {
+	t, err := time.Parse(clockLayout, clock)
+	if err != nil {
+		return 0, errors.Errorf("%q is not a time of day like \"22:00\"", clock)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// scheduleLocation returns the location of the ScheduleTimezone of wc,
+// UTC if it isn't set.
+func (wc WorkerConfig) scheduleLocation() (*time.Location, error) {
+	if wc.ScheduleTimezone == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(wc.ScheduleTimezone)
+	if err != nil {
+		return nil, errors.Errorf("unknown ScheduleTimezone %q", wc.ScheduleTimezone)
+	}
+
+	return loc, nil
+}
+
+// minWorkersAt returns the minimum number of workers of wc at t, which
+// is the MinWorkers of the first MinWorkersSchedule window containing t,
+// or MinWorkers outside of all of them. Invalid windows are ignored, as
+// ValidateConfig rejects them.
+func (wc WorkerConfig) minWorkersAt(t time.Time) int {
+	if len(wc.MinWorkersSchedule) == 0 {
+		return wc.MinWorkers
+	}
+
+	loc, err := wc.scheduleLocation()
+	if err != nil {
+		return wc.MinWorkers
+	}
+
+	t = t.In(loc)
+	for _, w := range wc.MinWorkersSchedule {
+		if ok, err := w.contains(t); err == nil && ok {
+			return w.MinWorkers
+		}
+	}
+
+	return wc.MinWorkers
+}
@@ -0,0 +1,140 @@
+package dynoscaler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+func TestCheckScalingMinWorkersSchedule(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone database unavailable: %s", err.Error())
+	}
+
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+		MinWorkersSchedule: []MinWorkersWindow{
+			{Start: "22:00", End: "06:00", MinWorkers: 3},
+			{Start: "06:00", End: "09:00", MinWorkers: 1},
+		},
+		ScheduleTimezone: "America/New_York",
+	}
+
+	tests := []struct {
+		now      time.Time
+		expected int
+	}{
+		{time.Date(2019, 1, 1, 21, 59, 0, 0, loc), 0},
+		{time.Date(2019, 1, 1, 22, 0, 0, 0, loc), 3},
+		{time.Date(2019, 1, 2, 5, 59, 0, 0, loc), 3},
+		{time.Date(2019, 1, 2, 6, 0, 0, 0, loc), 1},
+		{time.Date(2019, 1, 2, 8, 59, 0, 0, loc), 1},
+		{time.Date(2019, 1, 2, 9, 0, 0, 0, loc), 0},
+		// the schedule is in the ScheduleTimezone, not in the zone of
+		// the clock, so 11:00 UTC is still 06:00 in New York
+		{time.Date(2019, 1, 2, 10, 59, 0, 0, time.UTC), 3},
+		{time.Date(2019, 1, 2, 11, 0, 0, 0, time.UTC), 1},
+	}
+
+	for _, test := range tests {
+		ds := NewDynoScaler("", "", "", "", "")
+		now := test.now
+		ds.now = func() time.Time { return now }
+
+		ev, err := checkOnce(&ds,
+			wc,
+			[]rabbithole.QueueInfo{{Name: "foo", Messages: 0}},
+			[]heroku.Formation{{Type: "bar", Quantity: 5}},
+		)
+
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if ev.NewQuantity != test.expected {
+			t.Errorf("expected newQuantity at %s to be %d, got %d", test.now, test.expected, ev.NewQuantity)
+		}
+
+		if !ev.Scaled {
+			t.Errorf("expected scale at %s to be true", test.now)
+		}
+	}
+}
+
+func TestCheckScalingUpToScheduledMinWorkers(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+	ds.now = func() time.Time { return time.Date(2019, 1, 1, 23, 0, 0, 0, time.UTC) }
+
+	ev, err := checkOnce(&ds,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "foo",
+			WorkerType:      "bar",
+			MinWorkersSchedule: []MinWorkersWindow{
+				{Start: "22:00", End: "06:00", MinWorkers: 3},
+			},
+		},
+		[]rabbithole.QueueInfo{{Name: "foo", Messages: 1}},
+		[]heroku.Formation{{Type: "bar", Quantity: 0}},
+	)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ev.NewQuantity != 3 {
+		t.Errorf("expected newQuantity to be 3, got %d", ev.NewQuantity)
+	}
+
+	if !ev.Scaled {
+		t.Error("expected scale to be true")
+	}
+}
+
+func TestMinWorkersWindowAllDay(t *testing.T) {
+	w := MinWorkersWindow{Start: "00:00", End: "00:00", MinWorkers: 1}
+
+	ok, err := w.contains(time.Date(2019, 1, 1, 13, 37, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if !ok {
+		t.Error("expected a window from 00:00 to 00:00 to last all day")
+	}
+}
+
+func TestValidateConfigMinWorkersSchedule(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "", WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+		MaxWorkers:      2,
+		MinWorkersSchedule: []MinWorkersWindow{
+			{Start: "10pm", End: "06:00", MinWorkers: 1},
+			{Start: "06:00", End: "09:00", MinWorkers: 3},
+		},
+		ScheduleTimezone: "Nowhere/Special",
+	})
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	for _, expected := range []string{
+		`unknown ScheduleTimezone "Nowhere/Special"`,
+		`MinWorkersSchedule window 0: invalid Start: "10pm" is not a time of day like "22:00"`,
+		"MinWorkersSchedule window 1: MinWorkers must not be greater than MaxWorkers",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to contain %q, got %s", expected, err.Error())
+		}
+	}
+}
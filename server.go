@@ -0,0 +1,57 @@
+package dynoscaler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Handler returns an http.Handler serving the health and the status of
+// the scaler, e.g. to run it as a web dyno:
+//
+//	/healthz responds with 200 OK if a check succeeded within the
+//	HealthThreshold, and with 503 Service Unavailable otherwise.
+//
+//	/status responds with the Snapshot of the worker configs as JSON.
+func (ds *DynoScaler) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", ds.serveHealth)
+	mux.HandleFunc("/status", ds.serveStatus)
+
+	return mux
+}
+
+// ListenAndServe serves the Handler on the TCP address addr, e.g.
+// ":"+os.Getenv("PORT") on Heroku. It only returns once the server
+// fails, so it is usually run in a goroutine of its own next to Monitor.
+func (ds *DynoScaler) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, ds.Handler())
+}
+
+func (ds *DynoScaler) serveHealth(w http.ResponseWriter, r *http.Request) {
+	threshold := ds.HealthThreshold
+	if threshold <= 0 {
+		threshold = 3 * ds.CheckInterval
+	}
+
+	lastSuccess := ds.LastSuccess()
+	if lastSuccess.IsZero() {
+		http.Error(w, "no check has succeeded yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	if since := ds.now().Sub(lastSuccess); since > threshold {
+		http.Error(w, fmt.Sprintf("last successful check was %s ago", since), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+func (ds *DynoScaler) serveStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(ds.Snapshot()); err != nil {
+		ds.log.WithError(err).Error("failed to write status")
+	}
+}
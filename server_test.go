@@ -0,0 +1,118 @@
+package dynoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+func TestHandlerHealth(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.now = func() time.Time { return now }
+	ds.HealthThreshold = time.Minute
+
+	server := httptest.NewServer(ds.Handler())
+	defer server.Close()
+
+	healthz := func() int {
+		resp, err := http.Get(server.URL + "/healthz")
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	if code := healthz(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected status code to be 503 before the first check, got %d", code)
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if code := healthz(); code != http.StatusOK {
+		t.Errorf("expected status code to be 200 after a check, got %d", code)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if code := healthz(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected status code to be 503 once the check is too old, got %d", code)
+	}
+
+	rmqc.err = errors.New("connection refused")
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if code := healthz(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected status code to be 503 after a failed check, got %d", code)
+	}
+}
+
+func TestHandlerStatus(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.now = func() time.Time { return now }
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	server := httptest.NewServer(ds.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/status")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected Content-Type to be application/json, got %s", ct)
+	}
+
+	var statuses []WorkerStatus
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := WorkerStatus{
+		HerokuApp:       "app",
+		WorkerType:      "bar",
+		QueueName:       "foo",
+		TotalMessages:   1,
+		CurrentQuantity: 1,
+		DesiredQuantity: 1,
+		LastChecked:     now,
+		LastScaled:      now,
+	}
+	if len(statuses) != 1 || statuses[0] != expected {
+		t.Errorf("expected statuses to be [%+v], got %+v", expected, statuses)
+	}
+}
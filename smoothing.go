@@ -0,0 +1,87 @@
+package dynoscaler
+
+import (
+	"math"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// smoothed returns the backlog sample averaged with the backlogs of
+// the previous checks within the SmoothingWindow of qc, rounded up, or
+// their PercentileSignal if it is set. A sample reaching the
+// FastScaleThreshold of qc is returned as is, unless the smoothed
+// backlog is larger.
+func (ds *DynoScaler) smoothed(qc WorkerConfig, sample int) int {
+	if qc.SmoothingWindow <= 1 {
+		return sample
+	}
+
+	n := ds.smooth(qc, sample)
+	if qc.FastScaleThreshold > 0 && sample >= qc.FastScaleThreshold && sample > n {
+		ds.log.WithFields(logrus.Fields{
+			"heroku_app":  ds.appOf(qc),
+			"worker_type": qc.WorkerType,
+			"backlog":     sample,
+			"smoothed":    n,
+		}).Debug("backlog reached FastScaleThreshold, bypassing SmoothingWindow")
+
+		return sample
+	}
+
+	return n
+}
+
+// smooth does the work of smoothed, without the FastScaleThreshold.
+func (ds *DynoScaler) smooth(qc WorkerConfig, sample int) int {
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	samples := ds.state.worker(ds.appOf(qc), qc.WorkerType).samples
+	if len(samples) > qc.SmoothingWindow-1 {
+		samples = samples[len(samples)-(qc.SmoothingWindow-1):]
+	}
+
+	if qc.PercentileSignal > 0 {
+		return percentile(append([]int{sample}, samples...), qc.PercentileSignal)
+	}
+
+	sum := float64(sample)
+	for _, n := range samples {
+		sum += float64(n)
+	}
+
+	return int(math.Ceil(sum / float64(len(samples)+1)))
+}
+
+// percentile returns the p-th percentile of samples using the nearest
+// rank, i.e. the smallest sample which at least p percent of the
+// samples don't exceed. The samples are sorted in place.
+func percentile(samples []int, p float64) int {
+	sort.Ints(samples)
+
+	rank := int(math.Ceil(p / 100 * float64(len(samples))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	if rank > len(samples) {
+		rank = len(samples)
+	}
+
+	return samples[rank-1]
+}
+
+// addSample records the backlog sample of a check, keeping the last
+// window of them. The caller must hold the lock of the scaling state.
+func (ws *workerState) addSample(sample, window int) {
+	if window <= 1 {
+		ws.samples = nil
+		return
+	}
+
+	ws.samples = append(ws.samples, sample)
+	if len(ws.samples) > window {
+		ws.samples = append([]int(nil), ws.samples[len(ws.samples)-window:]...)
+	}
+}
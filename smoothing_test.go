@@ -0,0 +1,162 @@
+package dynoscaler
+
+import (
+	"reflect"
+	"testing"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+// noisyQuantities feeds the queue depths to CheckOnce one after
+// another, starting with current workers and applying the scalings,
+// and returns the quantities after each check.
+func noisyQuantities(t *testing.T, wc WorkerConfig, depths []int, current int) []int {
+	t.Helper()
+
+	ds := NewDynoScaler("", "", "", "", "")
+
+	var quantities []int
+	for _, depth := range depths {
+		ev, err := checkOnce(&ds,
+			wc,
+			[]rabbithole.QueueInfo{{Name: "foo", Messages: depth}},
+			[]heroku.Formation{{Type: "bar", Quantity: current}},
+		)
+		if err != nil {
+			t.Fatalf("expected error to be nil, got %s", err.Error())
+		}
+
+		if ev.Scaled {
+			current = ev.NewQuantity
+		}
+
+		quantities = append(quantities, current)
+	}
+
+	return quantities
+}
+
+func TestCheckScalingSmoothingWindow(t *testing.T) {
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2, 20: 3},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+	depths := []int{20, 0, 20, 0, 0, 0}
+
+	instant := noisyQuantities(t, wc, depths, 0)
+	if expected := []int{3, 0, 3, 0, 0, 0}; !reflect.DeepEqual(instant, expected) {
+		t.Errorf("expected instantaneous quantities to be %v, got %v", expected, instant)
+	}
+
+	wc.SmoothingWindow = 3
+
+	// the averages are 20, 10, 14, 7, 7 and 0
+	smoothed := noisyQuantities(t, wc, depths, 0)
+	if expected := []int{3, 3, 3, 3, 3, 0}; !reflect.DeepEqual(smoothed, expected) {
+		t.Errorf("expected smoothed quantities to be %v, got %v", expected, smoothed)
+	}
+}
+
+func TestCheckScalingFastScaleThreshold(t *testing.T) {
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2, 30: 5},
+		SmoothingWindow: 5,
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	}
+	depths := []int{0, 0, 0, 0, 30, 30}
+
+	// the averages are 0, 0, 0, 0, 6 and 12
+	smoothed := noisyQuantities(t, wc, depths, 0)
+	if expected := []int{0, 0, 0, 0, 1, 2}; !reflect.DeepEqual(smoothed, expected) {
+		t.Errorf("expected smoothed quantities to be %v, got %v", expected, smoothed)
+	}
+
+	wc.FastScaleThreshold = 25
+
+	// the burst bypasses the window
+	fast := noisyQuantities(t, wc, depths, 0)
+	if expected := []int{0, 0, 0, 0, 5, 5}; !reflect.DeepEqual(fast, expected) {
+		t.Errorf("expected fast quantities to be %v, got %v", expected, fast)
+	}
+}
+
+func TestCheckScalingPercentileSignal(t *testing.T) {
+	wc := WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 2, 50: 5, 100: 10},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+		SmoothingWindow: 10,
+	}
+	// nine samples of 5 and one of 100, whose average never gets
+	// beyond 24
+	depths := []int{5, 5, 5, 5, 100, 5, 5, 5, 5, 5}
+
+	mean := noisyQuantities(t, wc, depths, 0)
+	if expected := []int{1, 1, 1, 1, 2, 2, 2, 2, 2, 2}; !reflect.DeepEqual(mean, expected) {
+		t.Errorf("expected average quantities to be %v, got %v", expected, mean)
+	}
+
+	wc.PercentileSignal = 90
+
+	// the p90 is 100 from the spike on, as the window holds at most
+	// ten samples then
+	p90 := noisyQuantities(t, wc, depths, 0)
+	if expected := []int{1, 1, 1, 1, 10, 10, 10, 10, 10, 10}; !reflect.DeepEqual(p90, expected) {
+		t.Errorf("expected p90 quantities to be %v, got %v", expected, p90)
+	}
+
+	// with the full window, the p90 leaves out the spike while the p95
+	// doesn't
+	ds := NewDynoScaler("", "", "", "", "")
+	for _, depth := range depths[:9] {
+		ds.throttle(wc, evaluation{sample: depth, totalMsgs: depth})
+	}
+
+	if n := ds.smoothed(wc, 5); n != 5 {
+		t.Errorf("expected p90 of the full window to be 5, got %d", n)
+	}
+
+	wc.PercentileSignal = 95
+	if n := ds.smoothed(wc, 5); n != 100 {
+		t.Errorf("expected p95 of the full window to be 100, got %d", n)
+	}
+}
+
+func TestCheckScalingPercentileSignalWithoutWindow(t *testing.T) {
+	wc := WorkerConfig{
+		MsgWorkerRatios:  map[int]int{1: 1, 10: 2},
+		QueueName:        "foo",
+		WorkerType:       "bar",
+		PercentileSignal: 90,
+	}
+
+	quantities := noisyQuantities(t, wc, []int{10, 0}, 0)
+	if expected := []int{2, 0}; !reflect.DeepEqual(quantities, expected) {
+		t.Errorf("expected instantaneous quantities to be %v, got %v", expected, quantities)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	samples := []int{7, 1, 3, 10, 5, 2, 9, 4, 8, 6}
+
+	tests := map[float64]int{1: 1, 10: 1, 50: 5, 90: 9, 91: 10, 100: 10}
+	for p, expected := range tests {
+		if n := percentile(append([]int(nil), samples...), p); n != expected {
+			t.Errorf("expected p%g to be %d, got %d", p, expected, n)
+		}
+	}
+}
+
+func TestAddSampleKeepsWindow(t *testing.T) {
+	ws := &workerState{}
+	for _, n := range []int{1, 2, 3, 4, 5} {
+		ws.addSample(n, 3)
+	}
+
+	if expected := []int{3, 4, 5}; !reflect.DeepEqual(ws.samples, expected) {
+		t.Errorf("expected samples to be %v, got %v", expected, ws.samples)
+	}
+}
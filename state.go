@@ -0,0 +1,101 @@
+package dynoscaler
+
+import (
+	"sync"
+	"time"
+)
+
+// workerState holds what the scaler remembers about
+// a worker type of a Heroku app in between the checks.
+type workerState struct {
+	lastScaleUp   time.Time
+	lastScaleDown time.Time
+
+	// when the queue was first seen empty, zero while it isn't
+	emptySince time.Time
+
+	// when the checks started deciding to scale down, for the
+	// ScaleDownBufferTTL, zero while they don't
+	scaleDownSince time.Time
+
+	// the backlogs of the last checks for the SmoothingWindow, oldest
+	// first
+	samples []int
+}
+
+// scalingState holds the state of all worker types
+// of a DynoScaler.
+type scalingState struct {
+	// guards the worker configs of the DynoScaler, and is held for
+	// reading during the checks. Must be locked before mu.
+	configs sync.RWMutex
+
+	mu      sync.Mutex
+	workers map[workerKey]*workerState
+
+	// number of consecutive checks which failed to list the queues
+	listFailures int
+
+	// when the Heroku calls may be resumed after hitting the rate limit
+	rateLimitedUntil time.Time
+
+	// when a check last succeeded, and the error of the last failed one
+	lastSuccess   time.Time
+	lastError     error
+	lastErrorTime time.Time
+
+	// the outcome of the last check of each worker config, by index
+	statuses map[int]WorkerStatus
+
+	// the current MonitorContext call, if any
+	run *monitorRun
+
+	// whether the StateStore has been loaded
+	loaded bool
+
+	// when the scaler was started, for the PostDeployGrace
+	startedAt time.Time
+
+	// whether the scaling is paused, see Pause
+	paused bool
+}
+
+// monitorRun is a MonitorContext call, which returns once stop is
+// closed, and restarts its goroutines on a send to reload.
+type monitorRun struct {
+	stop   chan struct{}
+	once   sync.Once
+	reload chan struct{}
+}
+
+// stopRun stops r once, no matter how often it is called.
+func (r *monitorRun) stopRun() {
+	r.once.Do(func() { close(r.stop) })
+}
+
+func newScalingState() *scalingState {
+	return &scalingState{
+		workers:  make(map[workerKey]*workerState),
+		statuses: make(map[int]WorkerStatus),
+	}
+}
+
+// workerKey identifies a worker type of a Heroku app.
+type workerKey struct {
+	app        string
+	workerType string
+}
+
+// worker returns the state of workerType in app, initializing it
+// if it does not exist yet. The caller must hold s.mu.
+func (s *scalingState) worker(app, workerType string) *workerState {
+	key := workerKey{app: app, workerType: workerType}
+
+	ws, ok := s.workers[key]
+	if !ok {
+		ws = &workerState{}
+		s.workers[key] = ws
+	}
+
+	return ws
+}
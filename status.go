@@ -0,0 +1,128 @@
+package dynoscaler
+
+import (
+	"strings"
+	"time"
+)
+
+// WorkerStatus is the latest view the scaler has of a worker config.
+type WorkerStatus struct {
+	// The Heroku app and process of the worker config.
+	HerokuApp  string `json:"heroku_app"`
+	WorkerType string `json:"worker_type"`
+
+	// The queue(s) tracked by the worker config, separated by commas.
+	QueueName string `json:"queue_name"`
+
+	// The queue metric that was compared to MsgWorkerRatios during
+	// the last check. It keeps being updated while the Heroku API
+	// fails, as long as the queues can be listed.
+	TotalMessages int `json:"total_messages"`
+
+	// Number of dynos running after the last check.
+	CurrentQuantity int `json:"current_quantity"`
+
+	// Number of dynos the worker should be running according to the
+	// last check. Differs from CurrentQuantity if the scaling failed,
+	// was aborted or DryRun is enabled.
+	DesiredQuantity int `json:"desired_quantity"`
+
+	// When the worker config was last checked, zero if it hasn't
+	// been checked successfully yet.
+	LastChecked time.Time `json:"last_checked"`
+
+	// When the dynos of the worker were last scaled, zero if they
+	// haven't been scaled since the scaler was started.
+	LastScaled time.Time `json:"last_scaled"`
+}
+
+// Snapshot returns the status of each worker config, in the order of
+// the worker configs, e.g. for a status endpoint. It is safe to call
+// while the scaler is monitoring.
+func (ds *DynoScaler) Snapshot() []WorkerStatus {
+	ds.state.configs.RLock()
+	defer ds.state.configs.RUnlock()
+
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	statuses := make([]WorkerStatus, len(ds.workerConfigs))
+	for i, wc := range ds.workerConfigs {
+		status, ok := ds.state.statuses[i]
+		if !ok {
+			status = WorkerStatus{
+				HerokuApp:  ds.appOf(wc),
+				WorkerType: wc.WorkerType,
+				QueueName:  strings.Join(wc.queueNames(), ","),
+			}
+		}
+
+		statuses[i] = status
+	}
+
+	return statuses
+}
+
+// LastSuccess returns when a check last succeeded, zero if none has
+// yet, e.g. to alert once it is too long ago.
+func (ds *DynoScaler) LastSuccess() time.Time {
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	return ds.state.lastSuccess
+}
+
+// LastError returns the error of the last failed check, nil if none
+// has failed yet. It isn't reset by the checks which succeed.
+func (ds *DynoScaler) LastError() error {
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	return ds.state.lastError
+}
+
+// LastErrorTime returns when the check of LastError failed.
+func (ds *DynoScaler) LastErrorTime() time.Time {
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	return ds.state.lastErrorTime
+}
+
+// recordBacklog stores the backlog of the i-th worker config, when
+// it couldn't be checked, e.g. because the Heroku API is down. The
+// quantities and LastChecked are left as of the last check.
+func (ds *DynoScaler) recordBacklog(i int, app string, wc WorkerConfig, queueName string, backlog int) {
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	status := ds.state.statuses[i]
+	status.HerokuApp = app
+	status.WorkerType = wc.WorkerType
+	status.QueueName = queueName
+	status.TotalMessages = backlog
+
+	ds.state.statuses[i] = status
+}
+
+// recordStatus stores the outcome of checking the i-th worker config.
+func (ds *DynoScaler) recordStatus(i int, app string, wc WorkerConfig, ev evaluation, scaled bool) {
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	status := ds.state.statuses[i]
+	status.HerokuApp = app
+	status.WorkerType = wc.WorkerType
+	status.QueueName = ev.queueName
+	status.TotalMessages = ev.totalMsgs
+	status.CurrentQuantity = ev.oldQuantity
+	status.DesiredQuantity = ev.newQuantity
+	status.LastChecked = ds.now()
+
+	if scaled {
+		status.CurrentQuantity = ev.newQuantity
+		status.LastScaled = status.LastChecked
+	}
+
+	ds.state.statuses[i] = status
+}
@@ -0,0 +1,212 @@
+package dynoscaler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSnapshot(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{
+		{Type: "fooworker", Quantity: 1},
+		{Type: "barworker", Quantity: 2},
+	}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{
+		{Name: "foo", Messages: 10},
+		{Name: "bar", Messages: 2},
+	}}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	ds.now = func() time.Time { return now }
+
+	expected := []WorkerStatus{
+		{HerokuApp: "app", WorkerType: "fooworker", QueueName: "foo"},
+		{HerokuApp: "app", WorkerType: "barworker", QueueName: "bar"},
+	}
+	if snapshot := ds.Snapshot(); !reflect.DeepEqual(snapshot, expected) {
+		t.Errorf("expected snapshot before the first check to be %+v, got %+v", expected, snapshot)
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected = []WorkerStatus{
+		{
+			HerokuApp:       "app",
+			WorkerType:      "fooworker",
+			QueueName:       "foo",
+			TotalMessages:   10,
+			CurrentQuantity: 3,
+			DesiredQuantity: 3,
+			LastChecked:     now,
+			LastScaled:      now,
+		},
+		{
+			HerokuApp:       "app",
+			WorkerType:      "barworker",
+			QueueName:       "bar",
+			TotalMessages:   2,
+			CurrentQuantity: 2,
+			DesiredQuantity: 2,
+			LastChecked:     now,
+		},
+	}
+	if snapshot := ds.Snapshot(); !reflect.DeepEqual(snapshot, expected) {
+		t.Errorf("expected snapshot to be %+v, got %+v", expected, snapshot)
+	}
+}
+
+func TestSnapshotScaleFailed(t *testing.T) {
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{{Type: "fooworker", Quantity: 1}},
+		updateErr:  errors.New("unavailable"),
+	}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+		QueueName:       "foo",
+		WorkerType:      "fooworker",
+	})
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	status := ds.Snapshot()[0]
+
+	if status.CurrentQuantity != 1 || status.DesiredQuantity != 3 {
+		t.Errorf("expected current quantity 1 and desired quantity 3, got %d and %d", status.CurrentQuantity, status.DesiredQuantity)
+	}
+
+	if !status.LastScaled.IsZero() {
+		t.Errorf("expected LastScaled to be zero, got %s", status.LastScaled)
+	}
+}
+
+func TestSnapshotHerokuDown(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "fooworker", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+		QueueName:       "foo",
+		WorkerType:      "fooworker",
+	})
+	ds.now = func() time.Time { return now }
+
+	reg := prometheus.NewRegistry()
+	if err := ds.RegisterMetrics(reg); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	checked := now
+	now = now.Add(time.Minute)
+	hs.formationListErr = errors.New("unavailable")
+	rmqc.queues = []rabbithole.QueueInfo{{Name: "foo", Messages: 42, MessagesUnacknowledged: 8}}
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	expected := WorkerStatus{
+		HerokuApp:       "app",
+		WorkerType:      "fooworker",
+		QueueName:       "foo",
+		TotalMessages:   50,
+		CurrentQuantity: 3,
+		DesiredQuantity: 3,
+		LastChecked:     checked,
+		LastScaled:      checked,
+	}
+
+	if status := ds.Snapshot()[0]; status != expected {
+		t.Errorf("expected status to be %+v, got %+v", expected, status)
+	}
+
+	if v := testutil.ToFloat64(ds.metrics.queueBacklog.WithLabelValues("app", "fooworker", "foo")); v != 50 {
+		t.Errorf("expected foo backlog to be 50, got %v", v)
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 1 {
+		t.Errorf("expected only the first check to scale, got %+v", updates)
+	}
+}
+
+func TestLastSuccessAndError(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.now = func() time.Time { return now }
+
+	if !ds.LastSuccess().IsZero() || ds.LastError() != nil || !ds.LastErrorTime().IsZero() {
+		t.Fatal("expected nothing to be recorded before the first check")
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if ls := ds.LastSuccess(); !ls.Equal(now) {
+		t.Errorf("expected LastSuccess to be %s, got %s", now, ls)
+	}
+
+	if err := ds.LastError(); err != nil {
+		t.Errorf("expected LastError to be nil, got %s", err.Error())
+	}
+
+	succeeded := now
+	now = now.Add(time.Minute)
+	rmqc.err = errors.New("connection refused")
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if ls := ds.LastSuccess(); !ls.Equal(succeeded) {
+		t.Errorf("expected LastSuccess to stay %s, got %s", succeeded, ls)
+	}
+
+	err := ds.LastError()
+	if err == nil || err.Error() != "failed to list queues: connection refused" {
+		t.Errorf("expected LastError to be about listing the queues, got %v", err)
+	}
+
+	if lt := ds.LastErrorTime(); !lt.Equal(now) {
+		t.Errorf("expected LastErrorTime to be %s, got %s", now, lt)
+	}
+}
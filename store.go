@@ -0,0 +1,170 @@
+package dynoscaler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WorkerTimestamps are the times the cooldowns, the ScaleToZeroDelay
+// and the ScaleDownBufferTTL of a worker type of a Heroku app are based
+// on, as kept by a StateStore.
+type WorkerTimestamps struct {
+	HerokuApp      string    `json:"heroku_app"`
+	WorkerType     string    `json:"worker_type"`
+	LastScaleUp    time.Time `json:"last_scale_up"`
+	LastScaleDown  time.Time `json:"last_scale_down"`
+	EmptySince     time.Time `json:"empty_since"`
+	ScaleDownSince time.Time `json:"scale_down_since"`
+}
+
+// StateStore persists the WorkerTimestamps across restarts of the
+// scaler, so that e.g. a scale-down right after a restart is still
+// suppressed by the ScaleDownCooldown.
+type StateStore interface {
+	// Load returns the timestamps saved last, none if nothing has
+	// been saved yet.
+	Load() ([]WorkerTimestamps, error)
+
+	// Save replaces the saved timestamps with workers.
+	Save(workers []WorkerTimestamps) error
+}
+
+// FileStateStore is a StateStore which keeps the timestamps in a JSON
+// file, e.g. on a persistent disk.
+type FileStateStore struct {
+	// Path of the JSON file, which is created by the first Save.
+	Path string
+
+	// guards the file, since the worker configs with their own
+	// CheckInterval are checked concurrently
+	mu sync.Mutex
+}
+
+// NewFileStateStore returns a FileStateStore for the file at path.
+func NewFileStateStore(path string) *FileStateStore {
+	return &FileStateStore{Path: path}
+}
+
+// Load reads the timestamps from the file, none if it doesn't exist.
+func (s *FileStateStore) Load() ([]WorkerTimestamps, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read state")
+	}
+
+	var workers []WorkerTimestamps
+	if err := json.Unmarshal(data, &workers); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse state %s", s.Path)
+	}
+
+	return workers, nil
+}
+
+// Save writes the timestamps to a temporary file next to the file,
+// which then replaces it, so that a crash can't leave it half written.
+func (s *FileStateStore) Save(workers []WorkerTimestamps) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(workers)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode state")
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to write state")
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "failed to write state")
+	}
+
+	return errors.Wrap(os.Rename(f.Name(), s.Path), "failed to write state")
+}
+
+// loadState restores the timestamps of the StateStore, if any, the
+// first time it is called. A failure is only logged, since the scaler
+// works without them, just with its cooldowns starting over.
+func (ds *DynoScaler) loadState() {
+	ds.state.mu.Lock()
+	load := ds.StateStore != nil && !ds.state.loaded
+	ds.state.loaded = true
+	ds.state.mu.Unlock()
+
+	if !load {
+		return
+	}
+
+	workers, err := ds.StateStore.Load()
+	if err != nil {
+		ds.log.WithError(err).Warn("failed to load state, starting over")
+		return
+	}
+
+	ds.state.mu.Lock()
+	defer ds.state.mu.Unlock()
+
+	for _, w := range workers {
+		ws := ds.state.worker(w.HerokuApp, w.WorkerType)
+		ws.lastScaleUp = w.LastScaleUp
+		ws.lastScaleDown = w.LastScaleDown
+		ws.emptySince = w.EmptySince
+		ws.scaleDownSince = w.ScaleDownSince
+	}
+}
+
+// saveState saves the timestamps of all of the worker types to the
+// StateStore, if any. A failure is only logged, like in loadState.
+func (ds *DynoScaler) saveState() {
+	if ds.StateStore == nil {
+		return
+	}
+
+	ds.state.mu.Lock()
+	workers := make([]WorkerTimestamps, 0, len(ds.state.workers))
+	for key, ws := range ds.state.workers {
+		workers = append(workers, WorkerTimestamps{
+			HerokuApp:      key.app,
+			WorkerType:     key.workerType,
+			LastScaleUp:    ws.lastScaleUp,
+			LastScaleDown:  ws.lastScaleDown,
+			EmptySince:     ws.emptySince,
+			ScaleDownSince: ws.scaleDownSince,
+		})
+	}
+	ds.state.mu.Unlock()
+
+	// so that the file doesn't change with the random map order
+	sort.Slice(workers, func(a, b int) bool {
+		if workers[a].HerokuApp != workers[b].HerokuApp {
+			return workers[a].HerokuApp < workers[b].HerokuApp
+		}
+
+		return workers[a].WorkerType < workers[b].WorkerType
+	})
+
+	if err := ds.StateStore.Save(workers); err != nil {
+		ds.log.WithError(err).Warn("failed to save state")
+	}
+}
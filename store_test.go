@@ -0,0 +1,147 @@
+package dynoscaler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+// fakeStore is a StateStore which keeps the timestamps in memory.
+type fakeStore struct {
+	mu      sync.Mutex
+	workers []WorkerTimestamps
+	loads   int
+	saves   int
+	loadErr error
+}
+
+func (s *fakeStore) Load() ([]WorkerTimestamps, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loads++
+	return s.workers, s.loadErr
+}
+
+func (s *fakeStore) Save(workers []WorkerTimestamps) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saves++
+	s.workers = workers
+	return nil
+}
+
+func TestStateStoreSurvivesRestart(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeStore{}
+
+	newScaler := func(hs *fakeHeroku, rmqc *fakeRabbit) DynoScaler {
+		ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			QueueName:       "foo",
+			WorkerType:      "bar",
+		})
+		ds.now = func() time.Time { return now }
+		ds.ScaleDownCooldown = 10 * time.Minute
+		ds.StateStore = store
+
+		return ds
+	}
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 3}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 0}}}
+
+	ds := newScaler(hs, rmqc)
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := []WorkerTimestamps{{HerokuApp: "app", WorkerType: "bar", LastScaleDown: now, EmptySince: now, ScaleDownSince: now}}
+	if !reflect.DeepEqual(store.workers, expected) {
+		t.Fatalf("expected saved state to be %+v, got %+v", expected, store.workers)
+	}
+
+	// a new scaler, as after a restart, is still in the cooldown
+	now = now.Add(time.Minute)
+	hs = &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 3}}}
+
+	ds = newScaler(hs, rmqc)
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 0 {
+		t.Errorf("expected the restored ScaleDownCooldown to hold the scale-down, got %+v", updates)
+	}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if store.loads != 2 {
+		t.Errorf("expected the state to be loaded once per scaler, got %d loads", store.loads)
+	}
+}
+
+func TestStateStoreLoadFailure(t *testing.T) {
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.StateStore = &fakeStore{loadErr: errors.New("corrupt")}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 1 {
+		t.Errorf("expected the check to scale without the state, got %+v", updates)
+	}
+}
+
+func TestFileStateStore(t *testing.T) {
+	store := NewFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+
+	workers, err := store.Load()
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if len(workers) != 0 {
+		t.Errorf("expected no state before the first Save, got %+v", workers)
+	}
+
+	saved := []WorkerTimestamps{{
+		HerokuApp:      "app",
+		WorkerType:     "bar",
+		LastScaleUp:    time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC),
+		LastScaleDown:  time.Date(2019, 1, 1, 13, 0, 0, 0, time.UTC),
+		EmptySince:     time.Date(2019, 1, 1, 13, 30, 0, 0, time.UTC),
+		ScaleDownSince: time.Date(2019, 1, 1, 14, 0, 0, 0, time.UTC),
+	}}
+
+	if err := store.Save(saved); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	workers, err = NewFileStateStore(store.Path).Load()
+	if err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if !reflect.DeepEqual(workers, saved) {
+		t.Errorf("expected loaded state to be %+v, got %+v", saved, workers)
+	}
+}
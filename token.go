@@ -0,0 +1,106 @@
+package dynoscaler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// tokenTransport authorizes the requests to the Heroku Platform API
+// with a bearer token fetched from provider, and fetches a new token
+// when a request is rejected as unauthorized.
+type tokenTransport struct {
+	provider func(ctx context.Context) (string, error)
+
+	// used for the requests, http.DefaultTransport if nil
+	base http.RoundTripper
+
+	mu    sync.Mutex
+	token string
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.currentToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.send(req, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	resp.Body.Close()
+
+	token, err = t.refreshToken(req.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.Body != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, errors.Wrap(err, "failed to rewind request body")
+		}
+	}
+
+	return t.send(retry, token)
+}
+
+// send makes req authorized with token.
+func (t *tokenTransport) send(req *http.Request, token string) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return base.RoundTrip(req)
+}
+
+// currentToken returns the token to authorize the requests with,
+// fetching it if there is none yet.
+func (t *tokenTransport) currentToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" {
+		return t.token, nil
+	}
+
+	return t.fetchToken(ctx)
+}
+
+// refreshToken returns a new token to replace the rejected one. If
+// another request has already replaced it, its token is returned
+// without fetching another one.
+func (t *tokenTransport) refreshToken(ctx context.Context, rejected string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != rejected {
+		return t.token, nil
+	}
+
+	return t.fetchToken(ctx)
+}
+
+// fetchToken calls the provider for a new token. The caller must hold
+// t.mu.
+func (t *tokenTransport) fetchToken(ctx context.Context) (string, error) {
+	token, err := t.provider(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to fetch Heroku token")
+	}
+
+	t.token = token
+	return token, nil
+}
@@ -0,0 +1,164 @@
+package dynoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+// rotatingTokens returns a token provider which returns token-1,
+// token-2 and so on, and a function returning the number of calls.
+func rotatingTokens() (func(ctx context.Context) (string, error), func() int) {
+	var mu sync.Mutex
+	calls := 0
+
+	provider := func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		return fmt.Sprintf("token-%d", calls), nil
+	}
+
+	return provider, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return calls
+	}
+}
+
+func TestCheckOnceRefreshesHerokuToken(t *testing.T) {
+	var mu sync.Mutex
+	valid := "token-2"
+	var updates []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if auth := r.Header.Get("Authorization"); auth != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"id": "unauthorized", "message": "Invalid credentials provided."}`)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/apps/app/formation":
+			// expire the token before the formation update
+			valid = "token-3"
+			fmt.Fprint(w, `[{"type": "bar", "quantity": 1}]`)
+		case r.Method == "PATCH" && r.URL.Path == "/apps/app/formation/bar":
+			var opts heroku.FormationUpdateOpts
+			if err := json.NewDecoder(r.Body).Decode(&opts); err != nil || opts.Quantity == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			updates = append(updates, fmt.Sprintf("bar=%d", *opts.Quantity))
+			fmt.Fprintf(w, `{"type": "bar", "quantity": %d}`, *opts.Quantity)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider, calls := rotatingTokens()
+
+	ds := NewDynoScaler("", "", "", "", "app", WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 10: 3},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.HerokuURL = server.URL
+	ds.TokenProvider = provider
+	ds.rmqc = &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 10}}}
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	if c := calls(); c != 3 {
+		t.Errorf("expected token provider to be called 3 times, got %d", c)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !reflect.DeepEqual(updates, []string{"bar=3"}) {
+		t.Errorf("expected formation updates to be [bar=3], got %v", updates)
+	}
+}
+
+func TestCheckOnceRetriesUnauthorizedHerokuCallOnce(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"id": "unauthorized", "message": "Invalid credentials provided."}`)
+	}))
+	defer server.Close()
+
+	provider, calls := rotatingTokens()
+
+	ds := NewDynoScaler("", "", "", "", "app", WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.HerokuURL = server.URL
+	ds.TokenProvider = provider
+	ds.rmqc = &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if c := calls(); c != 2 {
+		t.Errorf("expected token provider to be called 2 times, got %d", c)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestCheckOnceTokenProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected no request, got %s %s", r.Method, r.URL.Path)
+	}))
+	defer server.Close()
+
+	ds := NewDynoScaler("", "", "", "", "app", WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.HerokuURL = server.URL
+	ds.TokenProvider = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("token endpoint unavailable")
+	}
+	ds.rmqc = &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	if err := ds.CheckOnce(context.Background()); err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+}
@@ -0,0 +1,238 @@
+package dynoscaler
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// ValidateConfig checks the worker configs (and the RabbitMQPort) for
+// mistakes which would otherwise only surface once the scaler is
+// running, e.g. a missing WorkerType, an empty MsgWorkerRatios map or
+// two worker configs scaling the same worker type. All of the problems
+// found are combined into the returned error, so that they can be
+// fixed in one go. MonitorContext calls it before it starts monitoring.
+func (ds *DynoScaler) ValidateConfig() error {
+	var errs multiError
+
+	if ds.RabbitMQPort < 0 || ds.RabbitMQPort > 65535 {
+		errs = append(errs, errors.Errorf("RabbitMQPort must be between 0 and 65535, got %d", ds.RabbitMQPort))
+	}
+
+	if ds.WorkerCeiling < 0 {
+		errs = append(errs, errors.Errorf("WorkerCeiling must not be negative, got %d", ds.WorkerCeiling))
+	}
+
+	if ds.PostDeployGrace < 0 {
+		errs = append(errs, errors.Errorf("PostDeployGrace must not be negative, got %s", ds.PostDeployGrace))
+	}
+
+	if ds.FormationMaxAge < 0 {
+		errs = append(errs, errors.Errorf("FormationMaxAge must not be negative, got %s", ds.FormationMaxAge))
+	}
+
+	if ds.CheckInterval < 0 {
+		errs = append(errs, errors.Errorf("CheckInterval must not be negative, got %s", ds.CheckInterval))
+	}
+
+	if ds.MaxTotalWorkers < 0 {
+		errs = append(errs, errors.Errorf("MaxTotalWorkers must not be negative, got %d", ds.MaxTotalWorkers))
+	}
+
+	ds.state.configs.RLock()
+	defer ds.state.configs.RUnlock()
+
+	for i, wc := range ds.workerConfigs {
+		for _, err := range wc.validate() {
+			errs = append(errs, errors.Wrapf(err, "worker config %d (%s)", i, wc.WorkerType))
+		}
+
+		if _, ok := ds.clusters[wc.RabbitMQCluster]; wc.RabbitMQCluster != "" && !ok {
+			errs = append(errs, errors.Errorf(
+				"worker config %d (%s) has an unknown RabbitMQCluster %s, add it with WithRabbitMQCluster",
+				i, wc.WorkerType, wc.RabbitMQCluster,
+			))
+		}
+
+		// the QueueSource only replaces the RabbitMQ given to NewDynoScaler
+		if ds.QueueSource != nil && wc.RabbitMQCluster == "" && wc.RatioMode == RatioByPublishRate {
+			errs = append(errs, errors.Errorf(
+				"worker config %d (%s) uses RatioByPublishRate, which needs the publish rates of the RabbitMQ Management API instead of a QueueSource",
+				i, wc.WorkerType,
+			))
+		}
+	}
+
+	// the worker configs of the same worker type would fight each other
+	configured := make(map[workerKey]int)
+	for i, wc := range ds.workerConfigs {
+		if wc.Disabled || wc.WorkerType == "" {
+			continue
+		}
+
+		key := workerKey{app: ds.appOf(wc), workerType: wc.WorkerType}
+		if first, ok := configured[key]; ok {
+			errs = append(errs, errors.Errorf(
+				"worker config %d (%s) has the same worker type of app %s as worker config %d, use QueueNames to track several queues",
+				i, wc.WorkerType, key.app, first,
+			))
+			continue
+		}
+
+		configured[key] = i
+	}
+
+	return errs.errOrNil()
+}
+
+// validate returns all of the problems found in wc.
+func (wc WorkerConfig) validate() []error {
+	var errs []error
+
+	if len(wc.queueNames()) == 0 && wc.QueueNamePattern == "" {
+		errs = append(errs, errors.New("QueueName, QueueNames or QueueNamePattern must be set"))
+	}
+
+	if wc.QueueNamePattern != "" {
+		if _, err := regexp.Compile(wc.QueueNamePattern); err != nil {
+			errs = append(errs, errors.Wrap(err, "invalid QueueNamePattern"))
+		}
+	}
+
+	if wc.WorkerType == "" {
+		errs = append(errs, errors.New("WorkerType must not be empty"))
+	}
+
+	if wc.RatioMode == RatioLinear {
+		if wc.MessagesPerWorker <= 0 {
+			errs = append(errs, errors.New("MessagesPerWorker must be positive when RatioMode is linear"))
+		}
+	} else if len(wc.MsgWorkerRatios) == 0 && wc.WorkersPerMessage == 0 {
+		errs = append(errs, errors.New("MsgWorkerRatios must not be empty"))
+	}
+
+	if wc.WorkersPerMessage < 0 {
+		errs = append(errs, fmt.Errorf("WorkersPerMessage must not be negative, got %g", wc.WorkersPerMessage))
+	}
+
+	keys := sortedKeys(wc.MsgWorkerRatios)
+	for i, msgs := range keys {
+		workers := wc.MsgWorkerRatios[msgs]
+		if msgs < 0 || workers < 0 {
+			errs = append(errs, fmt.Errorf("MsgWorkerRatios must not be negative, got %d: %d", msgs, workers))
+		}
+
+		// a larger queue must never result in fewer workers
+		if i > 0 {
+			prevMsgs := keys[i-1]
+			if prevWorkers := wc.MsgWorkerRatios[prevMsgs]; workers < prevWorkers {
+				errs = append(errs, fmt.Errorf(
+					"MsgWorkerRatios must not decrease as messages increase, but %d: %d follows %d: %d",
+					msgs, workers, prevMsgs, prevWorkers,
+				))
+			}
+		}
+	}
+
+	if wc.MinWorkers < 0 {
+		errs = append(errs, errors.New("MinWorkers must not be negative"))
+	}
+
+	if wc.MaxWorkers < 0 {
+		errs = append(errs, errors.New("MaxWorkers must not be negative"))
+	}
+
+	if wc.CheckInterval < 0 {
+		errs = append(errs, errors.New("CheckInterval must not be negative"))
+	}
+
+	if wc.ThresholdPolicy != ThresholdNone && (wc.RatioMode == RatioLinear || wc.RatioMode == RatioByUnacked) {
+		errs = append(errs, fmt.Errorf("ThresholdPolicy can't be used when RatioMode is %s", wc.RatioMode))
+	}
+
+	if wc.RateThreshold < 0 {
+		errs = append(errs, fmt.Errorf("RateThreshold must not be negative, got %g", wc.RateThreshold))
+	}
+
+	if wc.MaxMessageAge < 0 {
+		errs = append(errs, errors.New("MaxMessageAge must not be negative"))
+	} else if wc.RatioMode == RatioByMessageAge && wc.MaxMessageAge == 0 {
+		errs = append(errs, errors.New("MaxMessageAge must be set when RatioMode is message_age"))
+	}
+
+	// a stuck message adds a worker on every check
+	if wc.RatioMode == RatioByMessageAge && wc.MaxWorkers == 0 {
+		errs = append(errs, errors.New("MaxWorkers must be set when RatioMode is message_age"))
+	}
+
+	if wc.ScaleToZeroDelay < 0 {
+		errs = append(errs, errors.New("ScaleToZeroDelay must not be negative"))
+	}
+
+	if wc.ScaleDownBuffer < 0 {
+		errs = append(errs, fmt.Errorf("ScaleDownBuffer must not be negative, got %d", wc.ScaleDownBuffer))
+	}
+
+	if wc.ScaleDownBufferTTL < 0 {
+		errs = append(errs, errors.New("ScaleDownBufferTTL must not be negative"))
+	} else if wc.ScaleDownBuffer > 0 && wc.ScaleDownBufferTTL == 0 {
+		errs = append(errs, errors.New("ScaleDownBufferTTL must be set with a ScaleDownBuffer"))
+	}
+
+	if wc.ScaleUpThreshold < 0 {
+		errs = append(errs, errors.New("ScaleUpThreshold must not be negative"))
+	}
+
+	if wc.SmoothingWindow < 0 {
+		errs = append(errs, errors.New("SmoothingWindow must not be negative"))
+	}
+
+	if wc.Deadband < 0 {
+		errs = append(errs, fmt.Errorf("Deadband must not be negative, got %d", wc.Deadband))
+	}
+
+	if wc.MaxScaleUpStep > 0 && wc.Deadband >= wc.MaxScaleUpStep {
+		errs = append(errs, fmt.Errorf("Deadband must be less than MaxScaleUpStep, got %d", wc.Deadband))
+	}
+
+	if wc.FastScaleThreshold < 0 {
+		errs = append(errs, fmt.Errorf("FastScaleThreshold must not be negative, got %d", wc.FastScaleThreshold))
+	}
+
+	if wc.PercentileSignal < 0 || wc.PercentileSignal > 100 {
+		errs = append(errs, fmt.Errorf("PercentileSignal must be between 0 and 100, got %g", wc.PercentileSignal))
+	}
+
+	if wc.MaxScaleUpStep < 0 {
+		errs = append(errs, errors.New("MaxScaleUpStep must not be negative"))
+	}
+
+	if wc.ScaleDownStep < 0 {
+		errs = append(errs, errors.New("ScaleDownStep must not be negative"))
+	}
+
+	if wc.MaxWorkers > 0 && wc.MinWorkers > wc.MaxWorkers {
+		errs = append(errs, errors.New("MinWorkers must not be greater than MaxWorkers"))
+	}
+
+	if _, err := wc.scheduleLocation(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for i, w := range wc.MinWorkersSchedule {
+		if err := w.validate(); err != nil {
+			errs = append(errs, errors.Wrapf(err, "MinWorkersSchedule window %d", i))
+		}
+
+		if w.MinWorkers < 0 {
+			errs = append(errs, fmt.Errorf("MinWorkersSchedule window %d: MinWorkers must not be negative", i))
+		}
+
+		if wc.MaxWorkers > 0 && w.MinWorkers > wc.MaxWorkers {
+			errs = append(errs, fmt.Errorf("MinWorkersSchedule window %d: MinWorkers must not be greater than MaxWorkers", i))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,348 @@
+package dynoscaler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateConfig(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "",
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios:  map[int]int{1: 1},
+			QueueNamePattern: `^bar\.`,
+			WorkerType:       "barworker",
+		},
+	)
+
+	if err := ds.ValidateConfig(); err != nil {
+		t.Errorf("expected error to be nil, got %s", err.Error())
+	}
+}
+
+func TestValidateConfigCombinesErrors(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "",
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{},
+		},
+		WorkerConfig{
+			MsgWorkerRatios:  map[int]int{-1: 1, 5: 2},
+			QueueNamePattern: `bar.(`,
+			WorkerType:       "barworker",
+		},
+	)
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	errs, ok := err.(multiError)
+	if !ok {
+		t.Fatalf("expected a multiError, got %T", err)
+	}
+
+	if len(errs) != 5 {
+		t.Errorf("expected 5 errors, got %d: %s", len(errs), err.Error())
+	}
+
+	for _, msg := range []string{
+		"worker config 1 (): QueueName, QueueNames or QueueNamePattern must be set",
+		"worker config 1 (): WorkerType must not be empty",
+		"worker config 1 (): MsgWorkerRatios must not be empty",
+		"worker config 2 (barworker): invalid QueueNamePattern",
+		"worker config 2 (barworker): MsgWorkerRatios must not be negative, got -1: 1",
+	} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected error to contain %q, got %s", msg, err.Error())
+		}
+	}
+}
+
+func TestValidateConfigWorkerBounds(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "",
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			MinWorkers:      5,
+			MaxWorkers:      2,
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+	)
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if !strings.Contains(err.Error(), "MinWorkers must not be greater than MaxWorkers") {
+		t.Errorf("expected error about MinWorkers and MaxWorkers, got %s", err.Error())
+	}
+}
+
+func TestValidateConfigNonMonotonicRatios(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "",
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 5, 10: 2},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+	)
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	msg := "worker config 0 (fooworker): MsgWorkerRatios must not decrease as messages increase, but 10: 2 follows 1: 5"
+	if err.Error() != msg {
+		t.Errorf("expected error to be %q, got %q", msg, err.Error())
+	}
+}
+
+func TestValidateConfigMonotonicRatios(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "",
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2, 20: 2, 30: 5},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+	)
+
+	if err := ds.ValidateConfig(); err != nil {
+		t.Errorf("expected error to be nil, got %s", err.Error())
+	}
+}
+
+func TestValidateConfigRabbitMQPort(t *testing.T) {
+	for port, valid := range map[int]bool{0: true, 15672: true, 65535: true, -1: false, 65536: false} {
+		ds := NewDynoScaler("", "", "", "", "")
+		ds.RabbitMQPort = port
+
+		err := ds.ValidateConfig()
+		if valid && err != nil {
+			t.Errorf("expected port %d to be valid, got %s", port, err.Error())
+		}
+
+		if !valid && err == nil {
+			t.Errorf("expected port %d to be invalid", port)
+		}
+	}
+}
+
+func TestValidateConfigLinear(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "",
+		WorkerConfig{
+			RatioMode:         RatioLinear,
+			MessagesPerWorker: 10,
+			QueueName:         "foo",
+			WorkerType:        "fooworker",
+		},
+	)
+
+	if err := ds.ValidateConfig(); err != nil {
+		t.Errorf("expected error to be nil, got %s", err.Error())
+	}
+
+	ds = NewDynoScaler("", "", "", "", "",
+		WorkerConfig{
+			RatioMode:  RatioLinear,
+			QueueName:  "foo",
+			WorkerType: "fooworker",
+		},
+	)
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if !strings.Contains(err.Error(), "MessagesPerWorker must be positive") {
+		t.Errorf("expected error about MessagesPerWorker, got %s", err.Error())
+	}
+}
+
+func TestValidateConfigWorkersPerMessage(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "",
+		WorkerConfig{
+			WorkersPerMessage: 0.01,
+			QueueName:         "foo",
+			WorkerType:        "fooworker",
+		},
+	)
+
+	if err := ds.ValidateConfig(); err != nil {
+		t.Errorf("expected error to be nil, got %s", err.Error())
+	}
+
+	ds = NewDynoScaler("", "", "", "", "",
+		WorkerConfig{
+			WorkersPerMessage: -0.5,
+			QueueName:         "foo",
+			WorkerType:        "fooworker",
+		},
+	)
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	if !strings.Contains(err.Error(), "WorkersPerMessage must not be negative, got -0.5") {
+		t.Errorf("expected error about WorkersPerMessage, got %s", err.Error())
+	}
+}
+
+func TestValidateConfigMaxTotalWorkers(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "")
+	ds.MaxTotalWorkers = -1
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected a negative MaxTotalWorkers to be invalid")
+	}
+
+	if err.Error() != "MaxTotalWorkers must not be negative, got -1" {
+		t.Errorf("expected error about MaxTotalWorkers, got %s", err.Error())
+	}
+}
+
+func TestValidateConfigCheckInterval(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "", WithCheckInterval(-time.Second))
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected a negative CheckInterval to be invalid")
+	}
+
+	if err.Error() != "CheckInterval must not be negative, got -1s" {
+		t.Errorf("expected error about CheckInterval, got %s", err.Error())
+	}
+}
+
+func TestValidateConfigScaleDownBuffer(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "", WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		ScaleDownBuffer: 1,
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected a ScaleDownBuffer without a TTL to be invalid")
+	}
+
+	if !strings.Contains(err.Error(), "ScaleDownBufferTTL must be set with a ScaleDownBuffer") {
+		t.Errorf("expected error about ScaleDownBufferTTL, got %s", err.Error())
+	}
+}
+
+func TestValidateConfigRabbitMQCluster(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "app",
+		WithRabbitMQCluster("eu", "jaguar.rmq.cloudamqp.com", "", ""),
+		WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "foo", WorkerType: "foo", RabbitMQCluster: "eu"},
+		WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "bar", WorkerType: "bar", RabbitMQCluster: "us"},
+	)
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected an unknown RabbitMQCluster to be invalid")
+	}
+
+	expected := "worker config 1 (bar) has an unknown RabbitMQCluster us, add it with WithRabbitMQCluster"
+	if err.Error() != expected {
+		t.Errorf("expected error to be %q, got %q", expected, err.Error())
+	}
+}
+
+func TestValidateConfigQueueSourcePublishRate(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "app",
+		WithRabbitMQCluster("eu", "jaguar.rmq.cloudamqp.com", "", ""),
+		WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "foo", WorkerType: "foo", RatioMode: RatioByPublishRate},
+		WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "bar", WorkerType: "bar", RatioMode: RatioByPublishRate, RabbitMQCluster: "eu"},
+	)
+
+	if err := ds.ValidateConfig(); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	ds.QueueSource = NewPrometheusQueueSource("http://localhost:15692/metrics")
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected RatioByPublishRate with a QueueSource to be invalid")
+	}
+
+	expected := "worker config 0 (foo) uses RatioByPublishRate, which needs the publish rates of the RabbitMQ Management API instead of a QueueSource"
+	if err.Error() != expected {
+		t.Errorf("expected error to be %q, got %q", expected, err.Error())
+	}
+}
+
+func TestValidateConfigDeadband(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "", WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		Deadband:        1,
+		MaxScaleUpStep:  1,
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected a Deadband as large as the MaxScaleUpStep to be invalid")
+	}
+
+	if !strings.Contains(err.Error(), "Deadband must be less than MaxScaleUpStep, got 1") {
+		t.Errorf("expected error about MaxScaleUpStep, got %s", err.Error())
+	}
+}
+
+func TestValidateConfigMessageAgeWithoutMaxWorkers(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "", WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		RatioMode:       RatioByMessageAge,
+		MaxMessageAge:   time.Hour,
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected RatioByMessageAge without MaxWorkers to be invalid")
+	}
+
+	if !strings.Contains(err.Error(), "MaxWorkers must be set when RatioMode is message_age") {
+		t.Errorf("expected error about MaxWorkers, got %s", err.Error())
+	}
+}
+
+func TestValidateConfigDuplicateWorkerType(t *testing.T) {
+	ds := NewDynoScaler("", "", "", "", "app",
+		WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "foo", WorkerType: "worker"},
+		WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "bar", WorkerType: "worker"},
+		// the same worker type of another app is fine
+		WorkerConfig{MsgWorkerRatios: map[int]int{1: 1}, QueueName: "baz", WorkerType: "worker", HerokuAppID: "other"},
+	)
+
+	err := ds.ValidateConfig()
+	if err == nil {
+		t.Fatal("expected error to not be nil")
+	}
+
+	expected := "worker config 1 (worker) has the same worker type of app app as worker config 0, use QueueNames to track several queues"
+	if err.Error() != expected {
+		t.Errorf("expected error to be %q, got %q", expected, err.Error())
+	}
+}
@@ -0,0 +1,107 @@
+package dynoscaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// webhookTimeout is the longest a POST to the WebhookURL may take.
+const webhookTimeout = 5 * time.Second
+
+// webhookPayload is the JSON body POSTed to the WebhookURL.
+type webhookPayload struct {
+	HerokuApp     string    `json:"heroku_app"`
+	WorkerType    string    `json:"worker_type"`
+	QueueName     string    `json:"queue_name"`
+	From          int       `json:"from"`
+	To            int       `json:"to"`
+	TotalMessages int       `json:"total_messages"`
+	Decision      string    `json:"decision"`
+	Time          time.Time `json:"time"`
+}
+
+// slackPayload is the JSON body POSTed to the SlackWebhookURL, in the
+// format of the Slack incoming webhooks.
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+// slackText describes the scaling of ev in a Slack message, e.g.
+// ":arrow_up: scaled mainworker 2→5 (bar: 30 msgs)".
+func slackText(ev ScalingEvent) string {
+	emoji := ":arrow_up:"
+	if ev.NewQuantity < ev.OldQuantity {
+		emoji = ":arrow_down:"
+	}
+
+	return fmt.Sprintf(
+		"%s scaled %s %d→%d (%s: %d msgs)",
+		emoji, ev.WorkerType, ev.OldQuantity, ev.NewQuantity, ev.QueueName, ev.TotalMessages,
+	)
+}
+
+// notifyWebhook POSTs ev to the WebhookURL and the SlackWebhookURL in
+// the background if the worker was scaled, so that a slow webhook
+// doesn't hold up the check. Failures are only logged.
+func (ds *DynoScaler) notifyWebhook(ev ScalingEvent) {
+	if !ev.Scaled {
+		return
+	}
+
+	if ds.WebhookURL != "" {
+		ds.post(ds.WebhookURL, ev, webhookPayload{
+			HerokuApp:     ev.HerokuApp,
+			WorkerType:    ev.WorkerType,
+			QueueName:     ev.QueueName,
+			From:          ev.OldQuantity,
+			To:            ev.NewQuantity,
+			TotalMessages: ev.TotalMessages,
+			Decision:      ev.Decision.String(),
+			Time:          ev.Time,
+		})
+	}
+
+	if ds.SlackWebhookURL != "" {
+		ds.post(ds.SlackWebhookURL, ev, slackPayload{Text: slackText(ev)})
+	}
+}
+
+// post POSTs payload, which describes ev, to url in the background.
+func (ds *DynoScaler) post(url string, ev ScalingEvent, payload interface{}) {
+	go func() {
+		if err := postWebhook(url, payload); err != nil {
+			ds.log.WithError(err).WithFields(logrus.Fields{
+				"heroku_app":  ev.HerokuApp,
+				"worker_type": ev.WorkerType,
+			}).Warn("failed to notify webhook")
+		}
+	}()
+}
+
+// postWebhook POSTs payload to url as JSON.
+func postWebhook(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode webhook payload")
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to post webhook")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
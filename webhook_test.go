@@ -0,0 +1,203 @@
+package dynoscaler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	heroku "github.com/heroku/heroku-go/v3"
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+// syncBuffer is a bytes.Buffer which may be logged to in the background
+// while it is read.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestCheckOnceNotifiesWebhook(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	payloads := make(chan webhookPayload, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("expected a JSON payload, got %s", err.Error())
+		}
+
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("expected Content-Type to be application/json, got %s", ct)
+		}
+
+		payloads <- p
+	}))
+	defer server.Close()
+
+	hs := &fakeHeroku{
+		formations: []heroku.Formation{
+			{Type: "fooworker", Quantity: 0},
+			{Type: "barworker", Quantity: 1},
+		},
+	}
+	rmqc := &fakeRabbit{
+		queues: []rabbithole.QueueInfo{
+			{Name: "foo", Messages: 10},
+			{Name: "bar", Messages: 1},
+		},
+	}
+
+	ds := newTestDynoScaler(hs, rmqc,
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1, 10: 2},
+			QueueName:       "foo",
+			WorkerType:      "fooworker",
+		},
+		WorkerConfig{
+			MsgWorkerRatios: map[int]int{1: 1},
+			QueueName:       "bar",
+			WorkerType:      "barworker",
+		},
+	)
+	ds.now = func() time.Time { return now }
+	ds.WebhookURL = server.URL
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := webhookPayload{
+		HerokuApp:     "app",
+		WorkerType:    "fooworker",
+		QueueName:     "foo",
+		From:          0,
+		To:            2,
+		TotalMessages: 10,
+		Decision:      "scale_up",
+		Time:          now,
+	}
+
+	select {
+	case p := <-payloads:
+		if p != expected {
+			t.Errorf("expected payload to be %+v, got %+v", expected, p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the webhook to be notified")
+	}
+
+	// barworker wasn't scaled
+	select {
+	case p := <-payloads:
+		t.Errorf("expected only a single payload, got %+v", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestCheckOnceWebhookFailure(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		close(done)
+	}))
+	defer server.Close()
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "bar", Quantity: 0}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "foo", Messages: 1}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1},
+		QueueName:       "foo",
+		WorkerType:      "bar",
+	})
+	ds.WebhookURL = server.URL
+
+	var buf syncBuffer
+	ds.Logger.SetOutput(&buf)
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	<-done
+
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(buf.String(), "failed to notify webhook") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the webhook failure to be logged, got %q", buf.String())
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if updates := hs.updateCalls(); len(updates) != 1 {
+		t.Errorf("expected the formation to be updated regardless, got %+v", updates)
+	}
+}
+
+func TestCheckOnceNotifiesSlack(t *testing.T) {
+	bodies := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("expected a JSON payload, got %s", err.Error())
+		}
+
+		bodies <- body
+	}))
+	defer server.Close()
+
+	hs := &fakeHeroku{formations: []heroku.Formation{{Type: "mainworker", Quantity: 2}}}
+	rmqc := &fakeRabbit{queues: []rabbithole.QueueInfo{{Name: "bar", Messages: 30}}}
+
+	ds := newTestDynoScaler(hs, rmqc, WorkerConfig{
+		MsgWorkerRatios: map[int]int{1: 1, 30: 5},
+		QueueName:       "bar",
+		WorkerType:      "mainworker",
+	})
+	ds.SlackWebhookURL = server.URL
+
+	if err := ds.CheckOnce(context.Background()); err != nil {
+		t.Fatalf("expected error to be nil, got %s", err.Error())
+	}
+
+	expected := map[string]interface{}{"text": ":arrow_up: scaled mainworker 2→5 (bar: 30 msgs)"}
+
+	select {
+	case body := <-bodies:
+		if !reflect.DeepEqual(body, expected) {
+			t.Errorf("expected Slack payload to be %v, got %v", expected, body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the Slack webhook to be notified")
+	}
+}
+
+func TestSlackTextScaleDown(t *testing.T) {
+	text := slackText(ScalingEvent{WorkerType: "mainworker", QueueName: "bar", OldQuantity: 5, NewQuantity: 1})
+
+	if expected := ":arrow_down: scaled mainworker 5→1 (bar: 0 msgs)"; text != expected {
+		t.Errorf("expected text to be %q, got %q", expected, text)
+	}
+}
@@ -1,19 +1,458 @@
 package dynoscaler
 
+import (
+	"fmt"
+	"math"
+	"time"
+
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+)
+
+// RatioMode determines which queue metric the MsgWorkerRatios
+// of a WorkerConfig are compared against, or whether the workers
+// scale linearly with the queue instead.
+type RatioMode int
+
+const (
+	// RatioByDepth compares the ratios to the total number of
+	// queued and unacked messages. This is the default.
+	RatioByDepth RatioMode = iota
+
+	// RatioByPublishRate compares the ratios to the rate at which
+	// messages are published to the queue, in messages per second.
+	// The rate is rounded up to the nearest whole number, so a
+	// queue receiving any messages at all counts as at least 1.
+	RatioByPublishRate
+
+	// RatioLinear ignores MsgWorkerRatios, and instead uses one
+	// worker per MessagesPerWorker queued and unacked messages,
+	// rounded according to the RoundingMode.
+	RatioLinear
+
+	// RatioByMessageAge compares the ratios to the depth just like
+	// RatioByDepth, but also adds a worker whenever the oldest message
+	// of the queue is older than the MaxMessageAge, so that a few stuck
+	// messages still get attention. The age is taken from the timestamp
+	// property of the message at the head of the queue, which must be
+	// set by the publishers, as reported by the RabbitMQ Management API.
+	RatioByMessageAge
+
+	// RatioByUnacked compares the ratios to the number of unacked
+	// messages alone, which are delivered to the consumers but not
+	// acknowledged yet. A growing number of them while the ready
+	// messages stay flat hints at stuck or slow consumers, which more
+	// workers help with more than a backlog of ready messages does.
+	RatioByUnacked
+)
+
+var ratioModeNames = map[RatioMode]string{
+	RatioByDepth:       "depth",
+	RatioByPublishRate: "publish_rate",
+	RatioLinear:        "linear",
+	RatioByMessageAge:  "message_age",
+	RatioByUnacked:     "unacked",
+}
+
+func (m RatioMode) String() string {
+	if name, ok := ratioModeNames[m]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("RatioMode(%d)", int(m))
+}
+
+// MarshalText encodes the mode as its name, e.g. "publish_rate".
+func (m RatioMode) MarshalText() ([]byte, error) {
+	if _, ok := ratioModeNames[m]; !ok {
+		return nil, fmt.Errorf("unknown ratio mode %d", int(m))
+	}
+
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText decodes the mode from its name, e.g. "publish_rate",
+// which allows it to be used in configuration files.
+func (m *RatioMode) UnmarshalText(text []byte) error {
+	for mode, name := range ratioModeNames {
+		if name == string(text) {
+			*m = mode
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown ratio mode %q", text)
+}
+
+// ThresholdPolicy determines how the depth and the publish rate of
+// a queue are combined to decide on the number of workers.
+type ThresholdPolicy int
+
+const (
+	// ThresholdNone only uses the queue metric of the RatioMode.
+	// This is the default.
+	ThresholdNone ThresholdPolicy = iota
+
+	// ThresholdOr scales up once either the depth reaches the
+	// ScaleUpThreshold or the publish rate reaches the RateThreshold.
+	ThresholdOr
+
+	// ThresholdAnd only scales up once the depth reaches the
+	// ScaleUpThreshold and the publish rate reaches the RateThreshold,
+	// e.g. so that a backlog which isn't growing doesn't scale up.
+	ThresholdAnd
+)
+
+var thresholdPolicyNames = map[ThresholdPolicy]string{
+	ThresholdNone: "none",
+	ThresholdOr:   "or",
+	ThresholdAnd:  "and",
+}
+
+func (p ThresholdPolicy) String() string {
+	if name, ok := thresholdPolicyNames[p]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ThresholdPolicy(%d)", int(p))
+}
+
+// MarshalText encodes the policy as its name, e.g. "and".
+func (p ThresholdPolicy) MarshalText() ([]byte, error) {
+	if _, ok := thresholdPolicyNames[p]; !ok {
+		return nil, fmt.Errorf("unknown threshold policy %d", int(p))
+	}
+
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes the policy from its name, e.g. "and".
+func (p *ThresholdPolicy) UnmarshalText(text []byte) error {
+	for policy, name := range thresholdPolicyNames {
+		if name == string(text) {
+			*p = policy
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown threshold policy %q", text)
+}
+
+// RoundingMode determines how a fractional number of workers, e.g.
+// of RatioLinear or WorkersPerMessage, is rounded to whole workers.
+type RoundingMode int
+
+const (
+	// RoundUp rounds up, so that the workers are never under-provisioned.
+	// This is the default.
+	RoundUp RoundingMode = iota
+
+	// RoundDown rounds down.
+	RoundDown
+
+	// RoundNearest rounds to the nearest whole number, and halves up.
+	RoundNearest
+)
+
+var roundingModeNames = map[RoundingMode]string{
+	RoundUp:      "up",
+	RoundDown:    "down",
+	RoundNearest: "nearest",
+}
+
+func (m RoundingMode) String() string {
+	if name, ok := roundingModeNames[m]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("RoundingMode(%d)", int(m))
+}
+
+// MarshalText encodes the mode as its name, e.g. "nearest".
+func (m RoundingMode) MarshalText() ([]byte, error) {
+	if _, ok := roundingModeNames[m]; !ok {
+		return nil, fmt.Errorf("unknown rounding mode %d", int(m))
+	}
+
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText decodes the mode from its name, e.g. "nearest".
+func (m *RoundingMode) UnmarshalText(text []byte) error {
+	for mode, name := range roundingModeNames {
+		if name == string(text) {
+			*m = mode
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown rounding mode %q", text)
+}
+
+// round rounds the number of workers n according to m. The epsilon
+// keeps e.g. 100 * 0.07 from being rounded up to 8, and the result is
+// capped so that huge numbers don't overflow.
+func (m RoundingMode) round(n float64) int {
+	switch m {
+	case RoundDown:
+		n = math.Floor(n + 1e-9)
+	case RoundNearest:
+		n = math.Floor(n + 0.5 + 1e-9)
+	default:
+		n = math.Ceil(n - 1e-9)
+	}
+
+	if n > math.MaxInt32 {
+		return math.MaxInt32
+	}
+
+	return int(n)
+}
+
 // WorkerConfig holds the scaling settings for a specific dyno and queue.
 type WorkerConfig struct {
+	// Whether the worker config is skipped entirely by the checks,
+	// e.g. to ship it before it should take effect. The queues of a
+	// disabled worker config aren't looked up and its workers are
+	// never scaled.
+	Disabled bool `yaml:"disabled" json:"disabled"`
+
 	// Number of workers to use once the queue reaches a certain
 	// number of messages. For example, if {1: 1, 10: 2, 30: 5}
 	// was used, one worker would be used when the first message
 	// comes in, then if the queue grows to 10 messages, a second
 	// worker would be started up. Finally, if the queue grows to
 	// 30 messages, another 3 workers would be started up.
-	MsgWorkerRatios map[int]int
+	MsgWorkerRatios map[int]int `yaml:"msg_worker_ratios" json:"msg_worker_ratios"`
+
+	// Number of workers per message (or per message per second with
+	// RatioByPublishRate), used instead of MsgWorkerRatios when set.
+	// For example, 0.01 uses 10 workers per 1000 messages. The result
+	// is rounded according to the RoundingMode, so 250 messages would
+	// use 3 workers by default.
+	WorkersPerMessage float64 `yaml:"workers_per_message" json:"workers_per_message"`
+
+	// Whether to interpolate the number of workers linearly between the
+	// adjacent message counts of MsgWorkerRatios, instead of keeping the
+	// workers of the lower one until the next is reached. For example,
+	// with {10: 2, 30: 5}, 20 messages use 3.5 workers, which are rounded
+	// according to the RoundingMode. Ignored with WorkersPerMessage or
+	// RatioLinear.
+	Interpolate bool `yaml:"interpolate" json:"interpolate"`
+
+	// Which queue metric MsgWorkerRatios is compared against.
+	// Defaults to RatioByDepth.
+	RatioMode RatioMode `yaml:"ratio_mode" json:"ratio_mode"`
+
+	// If set, returns the message count of the queue, e.g. only its
+	// ready messages, instead of the queued and unacked messages summed
+	// up. It is used by every RatioMode but RatioByPublishRate and
+	// RatioByUnacked. When several queues are tracked it gets their
+	// counts summed up into a single QueueInfo.
+	BacklogFunc func(qInfo rabbithole.QueueInfo) int `yaml:"-" json:"-"`
+
+	// Age the oldest message of the queue may reach with
+	// RatioByMessageAge before another worker is added. As a stuck
+	// message adds a worker on every check, MaxWorkers must be set with
+	// it. The workers are limited by MaxScaleUpStep as well.
+	MaxMessageAge time.Duration `yaml:"max_message_age" json:"max_message_age"`
+
+	// How to round a fractional number of workers of WorkersPerMessage,
+	// RatioLinear or Interpolate. Defaults to RoundUp.
+	RoundingMode RoundingMode `yaml:"rounding_mode" json:"rounding_mode"`
+
+	// Number of messages each worker should handle when RatioMode is
+	// RatioLinear. For example, 10 would use one worker for 1 to 10
+	// messages, two workers for 11 to 20 messages, and so on.
+	MessagesPerWorker int `yaml:"messages_per_worker" json:"messages_per_worker"`
+
+	// Whether to divide the queue metric by the number of consumers
+	// of the queue before comparing it to MsgWorkerRatios, so that
+	// a queue which is already well served doesn't scale up any
+	// further. The result is rounded up, and a queue without any
+	// consumers is treated as having one.
+	ConsumerAware bool `yaml:"consumer_aware" json:"consumer_aware"`
+
+	// Whether to only scale up while the queue is active, i.e. while
+	// the Status of the queue isn't "idle", so that messages which sit
+	// in a queue nobody publishes to don't start any workers. With
+	// several queues, the workers are scaled up while any of them is
+	// active. Scaling down is not affected.
+	RequireActiveQueue bool `yaml:"require_active_queue" json:"require_active_queue"`
+
+	// Number of messages the queue must reach before the workers
+	// are scaled up at all, so that a small backlog which is quicker
+	// to work through than booting a dyno doesn't scale them up. Below
+	// it, the current quantity is kept. Zero means there is no
+	// threshold. Scaling down is not affected.
+	ScaleUpThreshold int `yaml:"scale_up_threshold" json:"scale_up_threshold"`
+
+	// How to combine the depth and the publish rate of the queue.
+	// Unless it is ThresholdNone, RatioMode is ignored, and the number
+	// of workers is the larger of the MsgWorkerRatios (or
+	// WorkersPerMessage) of the depth and of the rate, counting only the
+	// ones which reached their threshold. The workers are scaled down
+	// once the queue is empty and nothing is published to it anymore.
+	// Can't be used with RatioLinear.
+	ThresholdPolicy ThresholdPolicy `yaml:"threshold_policy" json:"threshold_policy"`
+
+	// Publish rate, in messages per second, the queue must reach for
+	// the ThresholdPolicy. Zero means any rate above zero.
+	RateThreshold float64 `yaml:"rate_threshold" json:"rate_threshold"`
+
+	// Number of checks to average the backlog over before deciding on
+	// the number of workers, including the current one, so that a
+	// momentary dip or spike of the queue doesn't scale the workers
+	// right away. The averaged backlog is rounded up, so the workers are
+	// only scaled down to MinWorkers once the queue has been empty for
+	// the whole window, and it is also the TotalMessages reported by the
+	// events. The publish rate of a ThresholdPolicy isn't averaged. Zero
+	// or one uses the backlog of the current check alone.
+	SmoothingWindow int `yaml:"smoothing_window" json:"smoothing_window"`
+
+	// Percentile of the backlogs within the SmoothingWindow to use
+	// instead of their average, from 0 to 100, e.g. 90 for bursty
+	// queues which shouldn't scale down on a transient dip. Zero uses
+	// the average. Without a SmoothingWindow, the backlog of the current
+	// check is used either way.
+	PercentileSignal float64 `yaml:"percentile_signal" json:"percentile_signal"`
+
+	// Backlog of a single check at which the SmoothingWindow is
+	// bypassed, so that a sudden burst on a latency-critical queue
+	// scales up right away instead of after a few checks. The backlog
+	// of the check is then used, unless the smoothed one is larger.
+	// Zero always smooths the backlog.
+	FastScaleThreshold int `yaml:"fast_scale_threshold" json:"fast_scale_threshold"`
+
+	// Minimum number of workers to keep running, even when the
+	// queue is empty. The workers of an empty queue settle at it,
+	// so fewer are scaled up to it as well. Zero means the workers
+	// may be scaled down to zero.
+	MinWorkers int `yaml:"min_workers" json:"min_workers"`
+
+	// Times of day with a different minimum number of workers than
+	// MinWorkers, e.g. a higher floor overnight. The first window
+	// containing the current time applies, and MinWorkers applies
+	// outside of all of them.
+	MinWorkersSchedule []MinWorkersWindow `yaml:"min_workers_schedule" json:"min_workers_schedule"`
+
+	// Name of the timezone the MinWorkersSchedule windows are in, e.g.
+	// "Europe/Berlin", as understood by time.LoadLocation. Defaults to
+	// UTC.
+	ScheduleTimezone string `yaml:"schedule_timezone" json:"schedule_timezone"`
+
+	// Maximum number of workers to add per check, so that a sudden
+	// spike ramps up over several checks instead of all at once.
+	// Zero means there is no limit.
+	MaxScaleUpStep int `yaml:"max_scale_up_step" json:"max_scale_up_step"`
+
+	// Whether to scale down by at most ScaleDownStep workers per
+	// check once the queue is empty, instead of going straight to
+	// MinWorkers, so that in-flight work isn't cut off all at once.
+	// Scaling up is not affected.
+	GradualScaleDown bool `yaml:"gradual_scale_down" json:"gradual_scale_down"`
+
+	// Number of workers to remove per check with GradualScaleDown.
+	// Zero means one.
+	ScaleDownStep int `yaml:"scale_down_step" json:"scale_down_step"`
+
+	// How long the queue must stay empty before the workers are scaled
+	// down, so that the messages in flight can still be acknowledged.
+	// The time is measured across the checks from when the queue is
+	// first seen empty, and starts over whenever messages reappear.
+	// Zero scales down as soon as the queue is empty.
+	ScaleToZeroDelay time.Duration `yaml:"scale_to_zero_delay" json:"scale_to_zero_delay"`
+
+	// Number of extra dynos to keep when scaling down, for the
+	// ScaleDownBufferTTL, so that the messages coming back soon after
+	// don't have to wait for the dynos to boot again. Unlike MinWorkers
+	// the buffer decays: once the TTL has passed since the scale-down
+	// started, the dynos are scaled down the rest of the way.
+	ScaleDownBuffer int `yaml:"scale_down_buffer" json:"scale_down_buffer"`
+
+	// How long the ScaleDownBuffer is kept. It is measured from the
+	// first check deciding to scale down, and starts over once a check
+	// doesn't.
+	ScaleDownBufferTTL time.Duration `yaml:"scale_down_buffer_ttl" json:"scale_down_buffer_ttl"`
+
+	// Number of workers the desired quantity may differ from the
+	// current one by without scaling, so that small oscillations such
+	// as 4→5→4 don't update the formation each time. With a Deadband
+	// of 1, wanting 5 workers while running 4 holds at 4. Scaling to or
+	// from zero ignores it, and so does settling the workers of an empty
+	// queue at MinWorkers. Zero scales on any difference.
+	Deadband int `yaml:"deadband" json:"deadband"`
+
+	// Maximum number of workers to ever scale up to, regardless of
+	// what MsgWorkerRatios would allow. Zero means there is no cap.
+	MaxWorkers int `yaml:"max_workers" json:"max_workers"`
+
+	// Priority of the worker config when the quantities of all of the
+	// worker configs exceed the MaxTotalWorkers of the DynoScaler.
+	// The higher priorities get their workers first, see MaxTotalWorkers.
+	// Defaults to zero, and may be negative.
+	Priority int `yaml:"priority" json:"priority"`
 
 	// Name of the AMQP queue to track.
-	QueueName string
+	QueueName string `yaml:"queue_name" json:"queue_name"`
+
+	// Names of additional AMQP queues to track, for workers
+	// consuming from several queues at once. The messages of
+	// all of the queues (including QueueName) are summed up.
+	QueueNames []string `yaml:"queue_names" json:"queue_names"`
+
+	// Regular expression matched against the names of all of the
+	// queues, for queues which are created dynamically. The messages
+	// of every matching queue are summed up together with the queues
+	// above. The expression is not anchored, so use ^ and $ to match
+	// complete names, e.g. `^orders\.tenant-\d+$`.
+	QueueNamePattern string `yaml:"queue_name_pattern" json:"queue_name_pattern"`
+
+	// Whether a queue which doesn't exist in RabbitMQ counts as an
+	// empty queue, e.g. for queues which are only declared on the
+	// first publish. By default, the check of the worker config fails
+	// until the queue exists.
+	TreatMissingQueueAsEmpty bool `yaml:"treat_missing_queue_as_empty" json:"treat_missing_queue_as_empty"`
+
+	// Whether a process type which isn't in the Heroku formation counts
+	// as having no dynos, as Heroku may leave out a process type until
+	// it has been scaled once. The formation is then updated to scale it
+	// up from zero. By default, the worker config is skipped with a
+	// warning.
+	AssumeZeroWhenFormationMissing bool `yaml:"assume_zero_when_formation_missing" json:"assume_zero_when_formation_missing"`
 
 	// Name of the process on Heroku.
 	// This is the same name you use in the Procfile.
-	WorkerType string
+	WorkerType string `yaml:"worker_type" json:"worker_type"`
+
+	// How long to sleep between the checks of this worker config.
+	// Defaults to the CheckInterval of the DynoScaler. The worker
+	// configs with the same interval are checked together.
+	CheckInterval time.Duration `yaml:"check_interval" json:"check_interval"`
+
+	// Heroku app the process runs in, for scaling the workers of
+	// several apps with one DynoScaler. Defaults to the app of the
+	// DynoScaler.
+	HerokuAppID string `yaml:"heroku_app_id" json:"heroku_app_id"`
+
+	// Name of the RabbitMQ cluster the queues live in, as added with
+	// WithRabbitMQCluster. Defaults to the RabbitMQ of the DynoScaler.
+	RabbitMQCluster string `yaml:"rabbitmq_cluster" json:"rabbitmq_cluster"`
+}
+
+// queueNames returns the names of all of the queues tracked
+// by wc, without duplicates.
+func (wc WorkerConfig) queueNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+
+	for _, name := range append([]string{wc.QueueName}, wc.QueueNames...) {
+		if name == "" || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	return names
 }
@@ -0,0 +1,20 @@
+package dynoscaler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueueNames(t *testing.T) {
+	wc := WorkerConfig{
+		QueueName:  "foo",
+		QueueNames: []string{"bar", "foo", "", "zoo"},
+	}
+
+	names := wc.queueNames()
+	expected := []string{"foo", "bar", "zoo"}
+
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected queue names to be %v, got %v", expected, names)
+	}
+}